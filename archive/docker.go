@@ -0,0 +1,278 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const (
+	LayerTar     = "layer.tar"
+	LayerJson    = "json"
+	VERSION      = "VERSION"
+	ManifestJson = "manifest.json"
+	Repositories = "repositories"
+
+	layerVersion = "1.0"
+	// epoch created time of v1 images of layers except the top one, same as `docker save`
+	epoch = "1970-01-01T00:00:00Z"
+)
+
+var (
+	// ErrDiffIDMismatch uncompressed layer doesn't match diff id in config
+	ErrDiffIDMismatch = errors.New("diff id mismatch")
+	// ErrLayerMissing layer is left out, but docker-archive requires every layer
+	ErrLayerMissing = errors.New("layer is missing")
+
+	// emptyContainerConfig marshaled empty container config of docker
+	emptyContainerConfig = json.RawMessage(`{"Hostname":"","Domainname":"","User":"","AttachStdin":false,"AttachStdout":false,"AttachStderr":false,"Tty":false,"OpenStdin":false,"StdinOnce":false,"Env":null,"Cmd":null,"Image":"","Volumes":null,"WorkingDir":"","Entrypoint":null,"OnBuild":null,"Labels":null}`)
+)
+
+type (
+	// v1Image legacy image json of layer directory, same fields as `image.V1Image` of docker
+	v1Image struct {
+		ID              string          `json:"id,omitempty"`
+		Parent          string          `json:"parent,omitempty"`
+		Comment         string          `json:"comment,omitempty"`
+		Created         json.RawMessage `json:"created"`
+		Container       string          `json:"container,omitempty"`
+		ContainerConfig json.RawMessage `json:"container_config,omitempty"`
+		DockerVersion   string          `json:"docker_version,omitempty"`
+		Author          string          `json:"author,omitempty"`
+		Config          json.RawMessage `json:"config,omitempty"`
+		Architecture    string          `json:"architecture,omitempty"`
+		Variant         string          `json:"variant,omitempty"`
+		OS              string          `json:"os,omitempty"`
+		Size            int64           `json:",omitempty"`
+	}
+
+	// imageConfig fields of config used by docker-archive
+	imageConfig struct {
+		v1Image
+		RootFS struct {
+			Type    string   `json:"type"`
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+
+	// dockerLayer layer with its ids in docker-archive
+	dockerLayer struct {
+		Layer
+		DiffID string
+		V1ID   string
+		json   []byte
+	}
+)
+
+// WriteDocker write images to dir with the layout of `docker save`: uncompressed
+// `<v1 id>/layer.tar` matching diff ids of config, `<config hex>.json`, `manifest.json`
+// and `repositories`. Layers shared by images are written once.
+func WriteDocker(dir string, images ...*Image) error {
+	return writeDocker(&dirSink{dir: dir}, images...)
+}
+
+// StreamDocker write images to w as tar of docker-archive, every layer is written
+// as soon as it's downloaded and decompressed, `manifest.json` is written last
+func StreamDocker(w io.Writer, images ...*Image) error {
+	s := newTarSink(w)
+	if err := writeDocker(s, images...); err != nil {
+		return err
+	}
+
+	return s.Close()
+}
+
+func writeDocker(s sink, images ...*Image) error {
+	var (
+		manifests    = make([]http.RootManifest, 0, len(images))
+		repositories = make(map[string]map[string]string)
+		written      = make(map[string]struct{})
+	)
+
+	for _, image := range images {
+		layers, configDigest, err := dockerLayers(image)
+		if err != nil {
+			return err
+		}
+
+		manifest := http.RootManifest{
+			Config:       configDigest[7:] + ".json",
+			RepoTags:     image.RepoTags,
+			Layers:       make([]string, 0, len(layers)),
+			LayerSources: make(map[string]http.Descriptor, len(layers)),
+		}
+		for _, layer := range layers {
+			manifest.Layers = append(manifest.Layers, layer.V1ID+"/"+LayerTar)
+			manifest.LayerSources[layer.DiffID] = layer.Descriptor
+			if _, ok := written[layer.V1ID]; ok {
+				continue
+			}
+			if err := writeDockerLayer(s, layer); err != nil {
+				return err
+			}
+			written[layer.V1ID] = struct{}{}
+		}
+		if len(manifest.LayerSources) == 0 {
+			manifest.LayerSources = nil
+		}
+
+		// tags of the same image share config
+		if _, ok := written[manifest.Config]; !ok {
+			if err := writeBytes(s, manifest.Config, image.Config); err != nil {
+				return err
+			}
+			written[manifest.Config] = struct{}{}
+		}
+		manifests = append(manifests, manifest)
+
+		if len(layers) > 0 {
+			top := layers[len(layers)-1].V1ID
+			for _, repoTag := range image.RepoTags {
+				name, tag := tools.SplitRepoTag(repoTag)
+				if repositories[name] == nil {
+					repositories[name] = make(map[string]string)
+				}
+				repositories[name][tag] = top
+			}
+		}
+	}
+
+	if err := writeJson(s, ManifestJson, manifests); err != nil {
+		return err
+	}
+	if len(repositories) > 0 {
+		return writeJson(s, Repositories, repositories)
+	}
+
+	return nil
+}
+
+// dockerLayers compute diff ids, chain ids and v1 compatibility ids of layers the same way as docker
+func dockerLayers(image *Image) ([]dockerLayer, string, error) {
+	var config imageConfig
+	if err := json.Unmarshal(image.Config, &config); err != nil {
+		return nil, "", fmt.Errorf("parse image config: %w", err)
+	}
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(image.Config))
+
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != len(image.Layers) {
+		return nil, "", fmt.Errorf("config %s has %d diff ids, but manifest has %d layers", configDigest, len(diffIDs), len(image.Layers))
+	}
+
+	var (
+		layers  = make([]dockerLayer, 0, len(diffIDs))
+		chainID string
+		parent  string
+	)
+	for index, diffID := range diffIDs {
+		v1 := v1Image{Created: json.RawMessage(`"` + epoch + `"`)}
+		if index == len(diffIDs)-1 {
+			v1 = config.v1Image
+			v1.ID, v1.Parent = "", ""
+			if v1.Created == nil {
+				v1.Created = json.RawMessage(`"0001-01-01T00:00:00Z"`)
+			}
+		}
+		if v1.ContainerConfig == nil {
+			v1.ContainerConfig = emptyContainerConfig
+		}
+
+		chainID = tools.ChainID(chainID, diffID)
+		v1ID, err := createV1ID(v1, chainID, parent)
+		if err != nil {
+			return nil, "", err
+		}
+
+		v1.ID = v1ID[7:]
+		if parent != "" {
+			v1.Parent = parent[7:]
+		}
+		v1.OS = config.OS
+		content, err := json.Marshal(v1)
+		if err != nil {
+			return nil, "", err
+		}
+
+		layers = append(layers, dockerLayer{
+			Layer:  image.Layers[index],
+			DiffID: diffID,
+			V1ID:   v1ID[7:],
+			json:   content,
+		})
+		parent = v1ID
+	}
+
+	return layers, configDigest, nil
+}
+
+// createV1ID same as `v1.CreateID` of docker, digest of v1 image with layer_id and parent
+func createV1ID(v1 v1Image, chainID, parent string) (string, error) {
+	v1.ID = ""
+	content, err := json.Marshal(v1)
+	if err != nil {
+		return "", err
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", err
+	}
+	config["layer_id"], _ = json.Marshal(chainID)
+	if parent != "" {
+		config["parent"], _ = json.Marshal(parent)
+	}
+
+	content, err = json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content)), nil
+}
+
+func writeDockerLayer(s sink, layer dockerLayer) error {
+	if err := writeBytes(s, path.Join(layer.V1ID, VERSION), []byte(layerVersion)); err != nil {
+		return err
+	}
+	if err := writeBytes(s, path.Join(layer.V1ID, LayerJson), layer.json); err != nil {
+		return err
+	}
+
+	if layer.Open == nil {
+		return fmt.Errorf("%w: layer %s", ErrLayerMissing, layer.Descriptor.Digest)
+	}
+	blob, err := layer.Open()
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	r, err := Decompress(blob)
+	if err != nil {
+		return fmt.Errorf("decompress %s: %w", layer.Descriptor.Digest, err)
+	}
+	defer r.Close()
+
+	err = s.writeFrom(path.Join(layer.V1ID, LayerTar), -1, newVerifyReader(r, layer.DiffID, ErrDiffIDMismatch))
+	if err != nil {
+		return fmt.Errorf("layer %s: %w", layer.Descriptor.Digest, err)
+	}
+
+	return nil
+}
+
+func writeJson(s sink, name string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return writeBytes(s, name, content)
+}
@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+// testLayer build gzip compressed layer and return it with diff id
+func testLayer(t *testing.T, name, content string) (Layer, string) {
+	t.Helper()
+
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(raw.Bytes())
+	gw.Close()
+
+	blob := compressed.Bytes()
+	return Layer{
+		Descriptor: http.Descriptor{
+			MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+			Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(blob)),
+			Size:      int64(len(blob)),
+		},
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(blob)), nil
+		},
+	}, fmt.Sprintf("sha256:%x", sha256.Sum256(raw.Bytes()))
+}
+
+func testImage(t *testing.T, repoTag string, layers ...string) *Image {
+	t.Helper()
+
+	image := &Image{RepoTags: []string{repoTag}}
+	var diffIDs []string
+	for index, content := range layers {
+		layer, diffID := testLayer(t, fmt.Sprintf("file-%d", index), content)
+		image.Layers = append(image.Layers, layer)
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	image.Config, _ = json.Marshal(map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      "2024-01-01T00:00:00Z",
+		"config":       map[string]any{"Cmd": []string{"sh"}, "Env": []string{"PATH=/bin"}},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+	})
+
+	return image
+}
+
+func TestWriteDockerRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	image := testImage(t, "docker.io/library/alpine:3", "base", "app")
+	if err := WriteDocker(dir, image); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "alpine.tar.gz")
+	if err := compress.Build(dir, output); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	manifests, err := reader.DockerManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 || manifests[0].RepoTags[0] != "docker.io/library/alpine:3" {
+		t.Fatalf("unexpected manifest: %+v", manifests)
+	}
+	manifest := manifests[0]
+
+	config, err := reader.ReadFile(manifest.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(config, image.Config) {
+		t.Fatal("config isn't kept byte for byte")
+	}
+	var parsed imageConfig
+	json.Unmarshal(config, &parsed)
+
+	var parent string
+	for index, layerPath := range manifest.Layers {
+		content, err := reader.ReadFile(layerPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diffID := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		if diffID != parsed.RootFS.DiffIDs[index] {
+			t.Fatalf("layer %d: diff id %s doesn't match config %s", index, diffID, parsed.RootFS.DiffIDs[index])
+		}
+		if source := manifest.LayerSources[diffID]; source.Digest != image.Layers[index].Descriptor.Digest {
+			t.Fatalf("layer %d: unexpected layer source: %+v", index, source)
+		}
+
+		v1ID := filepath.Dir(layerPath)
+		var v1 v1Image
+		content, err = reader.ReadFile(v1ID + "/" + LayerJson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.Unmarshal(content, &v1)
+		if v1.ID != v1ID || v1.Parent != parent {
+			t.Fatalf("layer %d: unexpected v1 image: id %s, parent %s", index, v1.ID, v1.Parent)
+		}
+		parent = v1ID
+	}
+
+	var repositories map[string]map[string]string
+	content, _ := reader.ReadFile(Repositories)
+	json.Unmarshal(content, &repositories)
+	if repositories["docker.io/library/alpine"]["3"] != parent {
+		t.Fatalf("unexpected repositories: %s", content)
+	}
+}
+
+func TestWriteDockerSharedLayers(t *testing.T) {
+	dir := t.TempDir()
+	first := testImage(t, "app:1.0", "base", "v1")
+	second := testImage(t, "app:1.1", "base", "v2")
+	if err := WriteDocker(dir, first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	firstLayers, _, _ := dockerLayers(first)
+	secondLayers, _, _ := dockerLayers(second)
+	if firstLayers[0].V1ID != secondLayers[0].V1ID {
+		t.Fatal("shared base layer should have the same v1 id")
+	}
+	if firstLayers[1].V1ID == secondLayers[1].V1ID {
+		t.Fatal("top layers should have different v1 ids")
+	}
+}
+
+func TestWriteDockerDiffIDMismatch(t *testing.T) {
+	image := testImage(t, "app:1.0", "base")
+	other, _ := testLayer(t, "other", "other")
+	image.Layers[0].Open = other.Open
+
+	if err := WriteDocker(t.TempDir(), image); !errors.Is(err, ErrDiffIDMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamDocker(t *testing.T) {
+	first := testImage(t, "app:1.0", "base", "v1")
+	second := testImage(t, "app:1.1", "base", "v2")
+
+	output := filepath.Join(t.TempDir(), "app.tar")
+	f, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StreamDocker(f, first, second); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	reader, err := OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	manifests, err := reader.DockerManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 2 || manifests[0].Layers[0] != manifests[1].Layers[0] {
+		t.Fatalf("unexpected manifests: %+v", manifests)
+	}
+	for _, manifest := range manifests {
+		for _, layerPath := range manifest.Layers {
+			if !reader.Has(layerPath) {
+				t.Fatalf("%s isn't written", layerPath)
+			}
+		}
+	}
+
+	// mismatched layer fails the stream
+	other, _ := testLayer(t, "other", "other")
+	first.Layers[0].Open = other.Open
+	if err := StreamDocker(io.Discard, first); !errors.Is(err, ErrDiffIDMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamDockerSameImage(t *testing.T) {
+	first := testImage(t, "app:1.0", "base", "v1")
+	second := testImage(t, "app:latest", "base", "v1")
+
+	var buf bytes.Buffer
+	if err := StreamDocker(&buf, first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]struct{})
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := seen[header.Name]; ok {
+			t.Fatalf("%s is written twice", header.Name)
+		}
+		seen[header.Name] = struct{}{}
+	}
+}
+
+func TestStreamDockerReproducible(t *testing.T) {
+	t.Setenv(compress.SourceDateEpoch, "1700000000")
+
+	stream := func(compression string) []byte {
+		var buf bytes.Buffer
+		w, err := compress.NewWriter(&buf, compression, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := testImage(t, "app:1.0", "base", "v1")
+		second := testImage(t, "app:1.1", "base", "v2")
+		if err := StreamDocker(w, first, second); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		return buf.Bytes()
+	}
+
+	for _, compression := range []string{compress.None, compress.Gzip, compress.Zstd} {
+		if !bytes.Equal(stream(compression), stream(compression)) {
+			t.Fatalf("%s: archive isn't reproducible", compression)
+		}
+	}
+
+	tr := tar.NewReader(bytes.NewReader(stream(compress.None)))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.ModTime.Unix() != 1700000000 || header.Uid != 0 || header.Gid != 0 {
+			t.Fatalf("%s: unexpected header: %+v", header.Name, header)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package archive
+
+import (
+	"io"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+type (
+	// Layer of image, Open return the compressed blob downloaded from registry. Open is nil
+	// if the blob is left out of archive, which is only allowed by OCI layout
+	Layer struct {
+		Descriptor http.Descriptor
+		Open       func() (io.ReadCloser, error)
+	}
+
+	// Image to be written to archive, Config and Manifest are raw blobs from registry
+	Image struct {
+		Config            []byte
+		ConfigMediaType   string
+		Manifest          []byte
+		ManifestMediaType string
+		Platform          *http.Platform
+		RepoTags          []string
+		Layers            []Layer
+	}
+)
+
+// Decompress return uncompressed stream of layer, compression is detected by content
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	return compress.NewReader(r)
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+// Layout OCI image layout used as store of one repository, whose tags point to manifests
+// or indexes in index.json, blobs are shared by all tags
+type Layout struct {
+	dir   string
+	sink  *dirSink
+	index *http.Index
+}
+
+// OpenLayout open layout in dir, which is created if it doesn't exist
+func OpenLayout(dir string) (*Layout, error) {
+	index, err := readOCIIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	layout := &Layout{dir: dir, sink: &dirSink{dir: dir}, index: index}
+	if !layout.sink.has(OCILayout) {
+		if err := writeBytes(layout.sink, OCILayout, []byte(ociLayoutContent)); err != nil {
+			return nil, err
+		}
+	}
+
+	return layout, nil
+}
+
+// Tags return descriptors of tagged manifests by tag
+func (l *Layout) Tags() map[string]http.Descriptor {
+	tags := make(map[string]http.Descriptor)
+	for _, desc := range l.index.Manifests {
+		if tag := desc.Annotations[AnnotationRefName]; tag != "" {
+			tags[tag] = desc
+		}
+	}
+
+	return tags
+}
+
+// HasBlob check whether blob is in layout
+func (l *Layout) HasBlob(digest string) bool {
+	name := blobPath(digest)
+	return name != "" && l.sink.has(name)
+}
+
+// ReadBlob read blob such as manifest in layout
+func (l *Layout) ReadBlob(digest string) ([]byte, error) {
+	name := blobPath(digest)
+	if name == "" {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+	}
+	content, err := os.ReadFile(filepath.Join(l.dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+	}
+
+	return content, err
+}
+
+// WriteBlob write blob if it isn't in layout, content is verified with digest
+func (l *Layout) WriteBlob(desc http.Descriptor, open func() (io.ReadCloser, error)) error {
+	return writeBlob(l.sink, desc, open)
+}
+
+// Tag point tag of repoTag such as `nginx:1.25` to desc, which replaces the previous one
+func (l *Layout) Tag(repoTag string, desc http.Descriptor) {
+	_, tag := tools.SplitRepoTag(repoTag)
+	desc.Annotations = map[string]string{AnnotationRefName: tag, AnnotationImageName: repoTag}
+	l.Untag(tag)
+	l.index.Manifests = append(l.index.Manifests, desc)
+}
+
+// Untag remove tag from index.json, blobs are kept
+func (l *Layout) Untag(tag string) {
+	manifests := l.index.Manifests[:0]
+	for _, desc := range l.index.Manifests {
+		if desc.Annotations[AnnotationRefName] != tag {
+			manifests = append(manifests, desc)
+		}
+	}
+	l.index.Manifests = manifests
+}
+
+// Save write index.json of layout
+func (l *Layout) Save() error {
+	return writeJson(l.sink, IndexJson, l.index)
+}
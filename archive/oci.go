@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const (
+	FormatDocker     = "docker"
+	FormatOCI        = "oci"
+	FormatOCIArchive = "oci-archive"
+
+	OCILayout = "oci-layout"
+	IndexJson = "index.json"
+	BLOBS     = "blobs"
+
+	MediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	AnnotationRefName   = "org.opencontainers.image.ref.name"
+	AnnotationImageName = "io.containerd.image.name"
+
+	ociLayoutContent = `{"imageLayoutVersion":"1.0.0"}`
+)
+
+var (
+	// ErrBlobDigestMismatch blob written to layout doesn't match its descriptor
+	ErrBlobDigestMismatch = errors.New("blob digest mismatch")
+	// ErrBlobNotFound blob isn't in archive
+	ErrBlobNotFound = errors.New("blob not found")
+)
+
+// ValidFormat check whether format is supported
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatDocker, FormatOCI, FormatOCIArchive:
+		return true
+	}
+	return false
+}
+
+// WriteOCI write images to dir with OCI image layout. Manifests, configs and compressed
+// layers are kept byte for byte, index.json of existing layout is merged, and manifest
+// with the same tag is replaced.
+func WriteOCI(dir string, images ...*Image) error {
+	index, err := readOCIIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	return writeOCI(&dirSink{dir: dir}, index, images...)
+}
+
+// StreamOCI write images to w as tar of OCI image layout, blobs are written as soon as
+// they are downloaded and `index.json` is written last
+func StreamOCI(w io.Writer, images ...*Image) error {
+	s := newTarSink(w)
+	if err := writeOCI(s, newOCIIndex(), images...); err != nil {
+		return err
+	}
+
+	return s.Close()
+}
+
+func writeOCI(s sink, index *http.Index, images ...*Image) error {
+	if err := writeBytes(s, OCILayout, []byte(ociLayoutContent)); err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		if image.Manifest == nil {
+			return errors.New("manifest of image is required by OCI layout")
+		}
+
+		for _, layer := range image.Layers {
+			if layer.Open == nil {
+				continue
+			}
+			if err := writeBlob(s, layer.Descriptor, layer.Open); err != nil {
+				return err
+			}
+		}
+		if _, err := writeBytesBlob(s, image.Config); err != nil {
+			return err
+		}
+		manifestDigest, err := writeBytesBlob(s, image.Manifest)
+		if err != nil {
+			return err
+		}
+
+		mediaType := image.ManifestMediaType
+		if mediaType == "" {
+			mediaType = MediaTypeOCIManifest
+		}
+		for _, repoTag := range image.RepoTags {
+			_, tag := tools.SplitRepoTag(repoTag)
+			addManifest(index, http.Descriptor{
+				MediaType: mediaType,
+				Digest:    manifestDigest,
+				Size:      int64(len(image.Manifest)),
+				Platform:  image.Platform,
+				Annotations: map[string]string{
+					AnnotationRefName:   tag,
+					AnnotationImageName: repoTag,
+				},
+			})
+		}
+		if len(image.RepoTags) == 0 {
+			addManifest(index, http.Descriptor{
+				MediaType: mediaType,
+				Digest:    manifestDigest,
+				Size:      int64(len(image.Manifest)),
+				Platform:  image.Platform,
+			})
+		}
+	}
+
+	return writeJson(s, IndexJson, index)
+}
+
+func newOCIIndex() *http.Index {
+	return &http.Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []http.Descriptor{}}
+}
+
+func readOCIIndex(dir string) (*http.Index, error) {
+	content, err := os.ReadFile(filepath.Join(dir, IndexJson))
+	if os.IsNotExist(err) {
+		return newOCIIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index http.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", IndexJson, err)
+	}
+
+	return &index, nil
+}
+
+// addManifest add descriptor to index.json, replace the one with the same image name or the same untagged digest
+func addManifest(i *http.Index, desc http.Descriptor) {
+	name := desc.Annotations[AnnotationImageName]
+	for index, item := range i.Manifests {
+		itemName := item.Annotations[AnnotationImageName]
+		if (name != "" && itemName == name) || (name == "" && itemName == "" && item.Digest == desc.Digest) {
+			i.Manifests[index] = desc
+			return
+		}
+	}
+
+	i.Manifests = append(i.Manifests, desc)
+}
+
+func writeBytesBlob(s sink, content []byte) (string, error) {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	desc := http.Descriptor{Digest: digest, Size: int64(len(content))}
+	return digest, writeBlob(s, desc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+}
+
+// writeBlob write blob to `blobs/sha256/<hex>` if it doesn't exist, content is verified with digest
+func writeBlob(s sink, desc http.Descriptor, open func() (io.ReadCloser, error)) error {
+	name := path.Join(BLOBS, "sha256", desc.Digest[7:])
+	if s.has(name) {
+		return nil
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	size := desc.Size
+	if size <= 0 {
+		size = -1
+	}
+
+	return s.writeFrom(name, size, newVerifyReader(r, desc.Digest, ErrBlobDigestMismatch))
+}
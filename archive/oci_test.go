@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+func TestWriteOCI(t *testing.T) {
+	image := testImage(t, "docker.io/library/alpine:3", "base", "app")
+	image.Manifest = []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	image.ManifestMediaType = MediaTypeOCIManifest
+
+	dir := t.TempDir()
+	// annotations and unknown fields of existing index.json are kept when merging
+	existing := `{"schemaVersion":2,"manifests":[],"annotations":{"owner":"ops"},"x-custom":{"a":1}}`
+	if err := os.WriteFile(filepath.Join(dir, IndexJson), []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteOCI(dir, image); err != nil {
+		t.Fatal(err)
+	}
+	// write again, manifest with the same name is replaced
+	if err := WriteOCI(dir, image); err != nil {
+		t.Fatal(err)
+	}
+
+	var index http.Index
+	content, err := os.ReadFile(filepath.Join(dir, IndexJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(content, &index)
+	if len(index.Manifests) != 1 {
+		t.Fatalf("unexpected manifests: %s", content)
+	}
+	if index.Annotations["owner"] != "ops" || string(index.Extra["x-custom"]) != `{"a":1}` {
+		t.Fatalf("fields of index.json are lost: %s", content)
+	}
+	desc := index.Manifests[0]
+	if desc.Annotations[AnnotationRefName] != "3" || desc.MediaType != MediaTypeOCIManifest {
+		t.Fatalf("unexpected descriptor: %+v", desc)
+	}
+
+	blobs := map[string][]byte{
+		desc.Digest: image.Manifest,
+		fmt.Sprintf("sha256:%x", sha256.Sum256(image.Config)): image.Config,
+	}
+	for _, layer := range image.Layers {
+		r, _ := layer.Open()
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		blobs[layer.Descriptor.Digest] = buf.Bytes()
+	}
+	for digest, want := range blobs {
+		got, err := os.ReadFile(filepath.Join(dir, BLOBS, "sha256", digest[7:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("blob %s isn't kept byte for byte", digest)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "alpine.tar")
+	if err := compress.Tar(dir, output); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if !reader.Has(OCILayout) || !reader.Has(IndexJson) || !reader.Has("blobs/sha256/"+desc.Digest[7:]) {
+		t.Fatal("oci-archive is incomplete")
+	}
+}
@@ -0,0 +1,277 @@
+package archive
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+type (
+	// Reader random access reader of tar archive, compressed archive is decompressed
+	// to temporary file first
+	Reader struct {
+		file    *os.File
+		temp    bool
+		entries map[string]entry
+		// blobs path of blobs in docker-archive by digest, built when it's needed
+		blobs map[string]string
+	}
+
+	entry struct {
+		offset int64
+		size   int64
+	}
+
+	countingReader struct {
+		r io.Reader
+		n int64
+	}
+)
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// OpenReader open tar archive, which may be compressed
+func OpenReader(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &Reader{file: f, entries: make(map[string]entry)}
+	compressed, err := isCompressed(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if compressed {
+		// decompress to temporary file to read entries randomly
+		if err := reader.decompress(); err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
+
+	if err := reader.index(); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func isCompressed(f *os.File) (bool, error) {
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return compress.IsCompressed(magic[:n]), nil
+}
+
+func (r *Reader) decompress() error {
+	tmp, err := os.CreateTemp("", "downer-archive-*.tar")
+	if err != nil {
+		return err
+	}
+
+	src := r.file
+	r.file, r.temp = tmp, true
+	defer src.Close()
+
+	dr, err := Decompress(src)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	_, err = io.Copy(tmp, dr)
+	return err
+}
+
+func (r *Reader) index() error {
+	if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	counter := &countingReader{r: r.file}
+	tr := tar.NewReader(counter)
+	links := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			r.resolveLinks(links)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(header.Name)
+		switch header.Typeflag {
+		case tar.TypeReg:
+			r.entries[name] = entry{offset: counter.n, size: header.Size}
+		case tar.TypeSymlink:
+			// `docker save` stores repeated layers as symlinks to the first one
+			target := header.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			links[name] = strings.TrimPrefix(path.Clean(target), "/")
+		case tar.TypeLink:
+			links[name] = path.Clean(header.Linkname)
+		}
+	}
+}
+
+// resolveLinks add symlinks and hardlinks to entries of files they point to, links to links are
+// followed, and links to missing files are skipped
+func (r *Reader) resolveLinks(links map[string]string) {
+	for name, target := range links {
+		for range len(links) {
+			next, ok := links[target]
+			if !ok {
+				break
+			}
+			target = next
+		}
+		if e, ok := r.entries[target]; ok {
+			r.entries[name] = e
+		}
+	}
+}
+
+// Has check whether file exists in archive
+func (r *Reader) Has(name string) bool {
+	_, ok := r.entries[path.Clean(name)]
+	return ok
+}
+
+// Size return size of file in archive
+func (r *Reader) Size(name string) (int64, error) {
+	e, ok := r.entries[path.Clean(name)]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+
+	return e.size, nil
+}
+
+// Open open file in archive
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	e, ok := r.entries[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+
+	return io.NopCloser(io.NewSectionReader(r.file, e.offset, e.size)), nil
+}
+
+// ReadFile read whole file in archive
+func (r *Reader) ReadFile(name string) ([]byte, error) {
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// DockerManifest read manifest.json of docker-archive
+func (r *Reader) DockerManifest() ([]http.RootManifest, error) {
+	content, err := r.ReadFile(ManifestJson)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []http.RootManifest
+	if err := json.Unmarshal(content, &manifests); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestJson, err)
+	}
+
+	return manifests, nil
+}
+
+// OpenBlob open blob by digest. Blobs of OCI layout are kept byte for byte, while
+// docker-archive keeps configs and uncompressed layers, which are found by digest of
+// compressed layer in LayerSources or by diff id
+func (r *Reader) OpenBlob(digest string) (io.ReadCloser, error) {
+	if len(digest) > 7 {
+		if name := path.Join(BLOBS, "sha256", digest[7:]); r.Has(name) {
+			return r.Open(name)
+		}
+	}
+
+	if r.blobs == nil {
+		if err := r.indexDockerBlobs(); err != nil {
+			return nil, err
+		}
+	}
+	name, ok := r.blobs[digest]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+	}
+
+	return r.Open(name)
+}
+
+func (r *Reader) indexDockerBlobs() error {
+	r.blobs = make(map[string]string)
+	if !r.Has(ManifestJson) {
+		return nil
+	}
+
+	manifests, err := r.DockerManifest()
+	if err != nil {
+		return err
+	}
+	for _, manifest := range manifests {
+		content, err := r.ReadFile(manifest.Config)
+		if err != nil {
+			return err
+		}
+		r.blobs[fmt.Sprintf("sha256:%x", sha256.Sum256(content))] = manifest.Config
+
+		var config imageConfig
+		if err := json.Unmarshal(content, &config); err != nil {
+			return fmt.Errorf("parse %s: %w", manifest.Config, err)
+		}
+		for index, diffID := range config.RootFS.DiffIDs {
+			if index >= len(manifest.Layers) {
+				break
+			}
+			r.blobs[diffID] = manifest.Layers[index]
+			if source, ok := manifest.LayerSources[diffID]; ok {
+				r.blobs[source.Digest] = manifest.Layers[index]
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close close archive and remove temporary file
+func (r *Reader) Close() error {
+	err := r.file.Close()
+	if r.temp {
+		os.Remove(r.file.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,37 @@
+package archive
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReaderLinks(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "links.tar")
+	f, _ := os.Create(output)
+	tw := tar.NewWriter(f)
+	tw.WriteHeader(&tar.Header{Name: "a/layer.tar", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("layer"))
+	tw.WriteHeader(&tar.Header{Name: "b/layer.tar", Linkname: "../a/layer.tar", Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "c/layer.tar", Linkname: "a/layer.tar", Typeflag: tar.TypeLink})
+	tw.WriteHeader(&tar.Header{Name: "d/layer.tar", Linkname: "../b/layer.tar", Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "e/layer.tar", Linkname: "../missing/layer.tar", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	f.Close()
+
+	r, err := OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, name := range []string{"b/layer.tar", "c/layer.tar", "d/layer.tar"} {
+		content, err := r.ReadFile(name)
+		if err != nil || string(content) != "layer" {
+			t.Fatalf("%s: got %q, %v", name, content, err)
+		}
+	}
+	if r.Has("e/layer.tar") {
+		t.Fatal("broken link is found")
+	}
+}
@@ -0,0 +1,186 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/anoyah/downer/compress"
+)
+
+type (
+	// sink destination of archive entries, which is a directory or a tar stream
+	sink interface {
+		// has check whether file has been written
+		has(name string) bool
+		// writeFrom write file from r, size is -1 if it's unknown until r is read
+		writeFrom(name string, size int64, r io.Reader) error
+	}
+
+	// dirSink write entries to directory, every file is written to temporary file then renamed
+	dirSink struct {
+		dir string
+	}
+
+	// tarSink write entries to tar stream as soon as they are complete, headers only
+	// depend on content so the same images always produce the same stream
+	tarSink struct {
+		tw      *tar.Writer
+		modTime time.Time
+		dirs    map[string]struct{}
+		written map[string]struct{}
+	}
+
+	// verifyReader return err instead of io.EOF if digest of content doesn't match
+	verifyReader struct {
+		r    io.Reader
+		hash hash.Hash
+		want string
+		err  error
+	}
+)
+
+func newTarSink(w io.Writer) *tarSink {
+	return &tarSink{
+		tw:      tar.NewWriter(w),
+		modTime: compress.Epoch(),
+		dirs:    make(map[string]struct{}),
+		written: make(map[string]struct{}),
+	}
+}
+
+func (s *dirSink) has(name string) bool {
+	_, err := os.Stat(filepath.Join(s.dir, name))
+	return err == nil
+}
+
+func (s *dirSink) writeFrom(name string, _ int64, r io.Reader) error {
+	target := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *tarSink) has(name string) bool {
+	_, ok := s.written[name]
+	return ok
+}
+
+func (s *tarSink) writeFrom(name string, size int64, r io.Reader) error {
+	if size < 0 {
+		// size is required by tar header, stage content to temporary file first
+		tmp, err := os.CreateTemp("", "downer-entry-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+
+	if err := s.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  s.modTime,
+	}
+	if err := s.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(s.tw, r); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	s.written[name] = struct{}{}
+
+	return nil
+}
+
+func (s *tarSink) mkdirAll(dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if _, ok := s.dirs[dir]; ok {
+		return nil
+	}
+	if err := s.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0o755,
+		ModTime:  s.modTime,
+	}
+	if err := s.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	s.dirs[dir] = struct{}{}
+
+	return nil
+}
+
+// Close flush the end of tar stream, the underlying writer isn't closed
+func (s *tarSink) Close() error {
+	return s.tw.Close()
+}
+
+func newVerifyReader(r io.Reader, want string, err error) *verifyReader {
+	return &verifyReader{r: r, hash: sha256.New(), want: want, err: err}
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := v.digest(); got != v.want {
+			return n, fmt.Errorf("%w: want %s, got %s", v.err, v.want, got)
+		}
+	}
+	return n, err
+}
+
+func (v *verifyReader) digest() string {
+	return fmt.Sprintf("sha256:%x", v.hash.Sum(nil))
+}
+
+func writeBytes(s sink, name string, content []byte) error {
+	return s.writeFrom(name, int64(len(content)), bytes.NewReader(content))
+}
@@ -0,0 +1,597 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const (
+	MediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeDockerIndex = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ErrUnknownSource path is neither OCI layout nor docker-archive
+var ErrUnknownSource = errors.New("unknown source")
+
+type (
+	// Source images read from docker-archive, OCI archive or OCI layout directory, layers
+	// are read from it when archive is written, so it should be closed after that
+	Source struct {
+		// Format of source: docker, oci or oci-archive
+		Format string
+		Images []*Image
+		close  func() error
+	}
+
+	// files read files of archive or directory by slash separated name
+	files interface {
+		Has(name string) bool
+		Size(name string) (int64, error)
+		Open(name string) (io.ReadCloser, error)
+		ReadFile(name string) ([]byte, error)
+	}
+
+	dirFiles struct {
+		dir string
+	}
+)
+
+// path return path of name in directory, name escaping the directory is rejected
+func (d *dirFiles) path(name string) (string, error) {
+	name = path.Clean(name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid name: %s is outside of %s", name, d.dir)
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+func (d *dirFiles) Has(name string) bool {
+	name, err := d.path(name)
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func (d *dirFiles) Size(name string) (int64, error) {
+	name, err := d.path(name)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (d *dirFiles) Open(name string) (io.ReadCloser, error) {
+	name, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+func (d *dirFiles) ReadFile(name string) ([]byte, error) {
+	name, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(name)
+}
+
+// OpenSource open docker-archive or OCI archive, which may be compressed, or directory of
+// OCI layout. Layout is detected by content: `index.json` for OCI, `manifest.json` or the
+// legacy `repositories` for docker-archive.
+func OpenSource(name string) (*Source, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		f      files
+		source = &Source{close: func() error { return nil }}
+	)
+	if fi.IsDir() {
+		f = &dirFiles{dir: name}
+		source.Format = FormatOCI
+	} else {
+		reader, err := OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		f = reader
+		source.Format = FormatOCIArchive
+		source.close = reader.Close
+	}
+
+	switch {
+	case f.Has(IndexJson):
+		source.Images, err = ociImages(f)
+	case f.Has(ManifestJson) || f.Has(Repositories):
+		source.Format = FormatDocker
+		source.Images, err = dockerImages(f)
+	default:
+		err = fmt.Errorf("%w: %s is neither OCI layout nor docker-archive", ErrUnknownSource, name)
+	}
+	if err == nil && len(source.Images) == 0 {
+		err = fmt.Errorf("no image in %s", name)
+	}
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// Close close archive of source
+func (s *Source) Close() error {
+	return s.close()
+}
+
+// Select return images of platform such as `linux/amd64`, all images if platform is empty
+func (s *Source) Select(platform string) []*Image {
+	if platform == "" {
+		return s.Images
+	}
+
+	var images []*Image
+	for _, image := range s.Images {
+		if image.Platform != nil && image.Platform.String() == platform {
+			images = append(images, image)
+		}
+	}
+	if len(images) == 0 {
+		// variant is optional, such as `linux/arm64` for `linux/arm64/v8`
+		for _, image := range s.Images {
+			if image.Platform != nil && image.Platform.OS+"/"+image.Platform.Architecture == platform {
+				images = append(images, image)
+			}
+		}
+	}
+
+	return images
+}
+
+// ociImages read images of index.json, nested indexes are expanded and attestation manifests are skipped
+func ociImages(f files) ([]*Image, error) {
+	content, err := f.ReadFile(IndexJson)
+	if err != nil {
+		return nil, err
+	}
+	var index http.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", IndexJson, err)
+	}
+
+	var (
+		images []*Image
+		seen   = make(map[string]*Image)
+	)
+	var collect func(descs []http.Descriptor, repoTag string) error
+	collect = func(descs []http.Descriptor, repoTag string) error {
+		for _, desc := range descs {
+			name := repoTag
+			if name == "" {
+				name = ociRepoTag(desc.Annotations)
+			}
+
+			switch desc.MediaType {
+			case MediaTypeOCIIndex, MediaTypeDockerIndex:
+				content, err := readBlob(f, desc.Digest)
+				if err != nil {
+					return err
+				}
+				var nested http.Index
+				if err := json.Unmarshal(content, &nested); err != nil {
+					return fmt.Errorf("parse index %s: %w", desc.Digest, err)
+				}
+				if err := collect(nested.Manifests, name); err != nil {
+					return err
+				}
+				continue
+			}
+			if desc.Platform != nil && (desc.Platform.OS == "unknown" || desc.Platform.Architecture == "unknown") {
+				continue
+			}
+
+			if image, ok := seen[desc.Digest]; ok {
+				if name != "" && !slices.Contains(image.RepoTags, name) {
+					image.RepoTags = append(image.RepoTags, name)
+				}
+				continue
+			}
+			image, err := ociImage(f, desc)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				image.RepoTags = []string{name}
+			}
+			seen[desc.Digest] = image
+			images = append(images, image)
+		}
+		return nil
+	}
+
+	if err := collect(index.Manifests, ""); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ociRepoTag return name of image in annotations, ref name is only used if it's a complete reference
+func ociRepoTag(annotations map[string]string) string {
+	name := annotations[AnnotationImageName]
+	if name == "" && strings.ContainsAny(annotations[AnnotationRefName], ":/") {
+		name = annotations[AnnotationRefName]
+	}
+	if name == "" {
+		return ""
+	}
+
+	ref, err := tools.ParseReference(name)
+	if err != nil || ref.Tag == "" {
+		return ""
+	}
+	return ref.FamiliarName() + ":" + ref.Tag
+}
+
+func ociImage(f files, desc http.Descriptor) (*Image, error) {
+	content, err := readBlob(f, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest http.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", desc.Digest, err)
+	}
+	config, err := readBlob(f, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		mediaType = manifest.MediaType
+	}
+	image := &Image{
+		Config:            config,
+		ConfigMediaType:   manifest.Config.MediaType,
+		Manifest:          content,
+		ManifestMediaType: mediaType,
+		Platform:          desc.Platform,
+	}
+	if image.Platform == nil {
+		image.Platform = configPlatform(config)
+	}
+	for _, layer := range manifest.Layers {
+		image.Layers = append(image.Layers, Layer{Descriptor: layer, Open: blobOpener(f, layer.Digest)})
+	}
+
+	return image, nil
+}
+
+// blobOpener return nil if blob isn't in layout, such as non-distributable layer
+func blobOpener(f files, digest string) func() (io.ReadCloser, error) {
+	name := blobPath(digest)
+	if name == "" || !f.Has(name) {
+		return nil
+	}
+
+	return func() (io.ReadCloser, error) {
+		return f.Open(name)
+	}
+}
+
+// blobPath return path of blob in layout, it's empty if digest is invalid
+func blobPath(digest string) string {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || !validDigestPart(algorithm, "abcdefghijklmnopqrstuvwxyz0123456789+._-") || !validDigestPart(hex, "0123456789abcdef") {
+		return ""
+	}
+	return path.Join(BLOBS, algorithm, hex)
+}
+
+func validDigestPart(s, chars string) bool {
+	return s != "" && strings.Trim(s, chars) == ""
+}
+
+func readBlob(f files, digest string) ([]byte, error) {
+	name := blobPath(digest)
+	if name == "" || !f.Has(name) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, digest)
+	}
+
+	return f.ReadFile(name)
+}
+
+// dockerImages read images of manifest.json, names missing in it are taken from
+// `repositories`, archive of the legacy format only has `repositories`
+func dockerImages(f files) ([]*Image, error) {
+	repositories, err := readRepositories(f)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Has(ManifestJson) {
+		return legacyDockerImages(f, repositories)
+	}
+
+	content, err := f.ReadFile(ManifestJson)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []http.RootManifest
+	if err := json.Unmarshal(content, &manifests); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestJson, err)
+	}
+
+	images := make([]*Image, 0, len(manifests))
+	for _, manifest := range manifests {
+		config, err := f.ReadFile(manifest.Config)
+		if err != nil {
+			return nil, err
+		}
+		repoTags := manifest.RepoTags
+		if len(repoTags) == 0 && len(manifest.Layers) > 0 {
+			repoTags = repositories[path.Dir(manifest.Layers[len(manifest.Layers)-1])]
+		}
+
+		var parsed imageConfig
+		if err := json.Unmarshal(config, &parsed); err != nil {
+			return nil, fmt.Errorf("parse image config: %w", err)
+		}
+		if len(parsed.RootFS.DiffIDs) != len(manifest.Layers) {
+			return nil, fmt.Errorf("config has %d diff ids, but archive has %d layers", len(parsed.RootFS.DiffIDs), len(manifest.Layers))
+		}
+		descs, _, err := layerDescriptors(f, manifest.Layers, parsed.RootFS.DiffIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		image, err := dockerImage(f, config, manifest.Layers, descs, repoTags)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// readRepositories return repo tags by id of top layer
+func readRepositories(f files) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	if !f.Has(Repositories) {
+		return tags, nil
+	}
+
+	content, err := f.ReadFile(Repositories)
+	if err != nil {
+		return nil, err
+	}
+	var repositories map[string]map[string]string
+	if err := json.Unmarshal(content, &repositories); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", Repositories, err)
+	}
+	for name, items := range repositories {
+		for tag, id := range items {
+			tags[id] = append(tags[id], name+":"+tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// legacyDockerImages build config of every tagged image from json of its layers, diff ids are
+// computed from uncompressed layer.tar
+func legacyDockerImages(f files, repositories map[string][]string) ([]*Image, error) {
+	tops := make([]string, 0, len(repositories))
+	for top := range repositories {
+		tops = append(tops, top)
+	}
+	sort.Strings(tops)
+
+	var images []*Image
+	for _, top := range tops {
+		repoTags := repositories[top]
+		sort.Strings(repoTags)
+		var (
+			layers []string
+			config *http.ImageConfig
+		)
+		for id := top; id != ""; {
+			content, err := f.ReadFile(path.Join(id, LayerJson))
+			if err != nil {
+				return nil, err
+			}
+			var v1 struct {
+				Parent string `json:"parent"`
+			}
+			if err := json.Unmarshal(content, &v1); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path.Join(id, LayerJson), err)
+			}
+			if config == nil {
+				// image json of top layer is image config with legacy fields
+				config = new(http.ImageConfig)
+				if err := json.Unmarshal(content, config); err != nil {
+					return nil, fmt.Errorf("parse %s: %w", path.Join(id, LayerJson), err)
+				}
+			}
+			layers = append([]string{path.Join(id, LayerTar)}, layers...)
+			id = v1.Parent
+		}
+
+		descs, diffIDs, err := layerDescriptors(f, layers, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range []string{"id", "parent", "layer_id", "parent_id", "Size"} {
+			delete(config.Extra, key)
+		}
+		config.RootFS = http.RootFS{Type: "layers", DiffIDs: diffIDs}
+		content, err := json.Marshal(config)
+		if err != nil {
+			return nil, err
+		}
+
+		image, err := dockerImage(f, content, layers, descs, repoTags)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// dockerImage build OCI manifest of docker-archive image with descriptors of its layers
+func dockerImage(f files, config []byte, layers []string, descs []http.Descriptor, repoTags []string) (*Image, error) {
+	manifest := http.Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config: http.Descriptor{
+			MediaType: MediaTypeOCIConfig,
+			Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(config)),
+			Size:      int64(len(config)),
+		},
+		Layers: make([]http.Descriptor, 0, len(layers)),
+	}
+	image := &Image{
+		Config:            config,
+		ConfigMediaType:   MediaTypeOCIConfig,
+		ManifestMediaType: MediaTypeOCIManifest,
+		Platform:          configPlatform(config),
+		RepoTags:          repoTags,
+	}
+	for index, name := range layers {
+		desc := descs[index]
+		manifest.Layers = append(manifest.Layers, desc)
+		image.Layers = append(image.Layers, Layer{
+			Descriptor: desc,
+			Open: func() (io.ReadCloser, error) {
+				return f.Open(name)
+			},
+		})
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	image.Manifest = content
+
+	return image, nil
+}
+
+// configPlatform return platform in image config
+func configPlatform(config []byte) *http.Platform {
+	var parsed http.ImageConfig
+	if err := json.Unmarshal(config, &parsed); err != nil || parsed.OS == "" || parsed.Architecture == "" {
+		return nil
+	}
+
+	return parsed.Platform()
+}
+
+// layerDescriptors return descriptors of layer.tar files and their diff ids, which are computed if
+// diffIDs is nil. Docker stores uncompressed layers whose digests are diff ids, but archives
+// written by old versions of downer store gzip layers as downloaded.
+func layerDescriptors(f files, layers, diffIDs []string) ([]http.Descriptor, []string, error) {
+	descs := make([]http.Descriptor, 0, len(layers))
+	computed := make([]string, 0, len(layers))
+	for index, name := range layers {
+		var diffID string
+		if diffIDs != nil {
+			diffID = diffIDs[index]
+		}
+		desc, diffID, err := layerDescriptor(f, name, diffID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		descs = append(descs, desc)
+		computed = append(computed, diffID)
+	}
+
+	return descs, computed, nil
+}
+
+// layerDescriptor detect compression of layer.tar, compressed layer is hashed to get its digest,
+// and diff id is computed from decompressed stream if it's empty
+func layerDescriptor(f files, name, diffID string) (http.Descriptor, string, error) {
+	size, err := f.Size(name)
+	if err != nil {
+		return http.Descriptor{}, "", err
+	}
+	r, err := f.Open(name)
+	if err != nil {
+		return http.Descriptor{}, "", err
+	}
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+	compression := compress.Detect(header)
+	if compression == compress.None {
+		if diffID == "" {
+			if diffID, err = digestReader(br); err != nil {
+				return http.Descriptor{}, "", err
+			}
+		}
+		return http.Descriptor{MediaType: MediaTypeOCILayer, Digest: diffID, Size: size}, diffID, nil
+	}
+
+	hash := sha256.New()
+	tee := io.TeeReader(br, hash)
+	if diffID == "" {
+		zr, err := compress.NewReader(tee)
+		if err != nil {
+			return http.Descriptor{}, "", err
+		}
+		diffID, err = digestReader(zr)
+		zr.Close()
+		if err != nil {
+			return http.Descriptor{}, "", err
+		}
+	}
+	// rest of compressed stream isn't read by decompressor, such as padding
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return http.Descriptor{}, "", err
+	}
+
+	desc := http.Descriptor{
+		MediaType: MediaTypeOCILayer + "+" + compression,
+		Digest:    fmt.Sprintf("sha256:%x", hash.Sum(nil)),
+		Size:      size,
+	}
+	return desc, diffID, nil
+}
+
+func digestReader(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+func readAll(t *testing.T, open func() (io.ReadCloser, error)) []byte {
+	t.Helper()
+
+	r, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestOpenSourceDocker(t *testing.T) {
+	image := testImage(t, "alpine:3", "base", "app")
+	output := filepath.Join(t.TempDir(), "alpine.tar")
+	f, _ := os.Create(output)
+	if err := StreamDocker(f, image); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	source, err := OpenSource(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	if source.Format != FormatDocker || len(source.Images) != 1 {
+		t.Fatalf("unexpected source: %s with %d images", source.Format, len(source.Images))
+	}
+	got := source.Images[0]
+	if !bytes.Equal(got.Config, image.Config) || got.RepoTags[0] != "alpine:3" || got.Platform.String() != "linux/amd64" {
+		t.Fatalf("unexpected image: %+v", got)
+	}
+
+	// layers are uncompressed tar whose digests are diff ids
+	var config imageConfig
+	json.Unmarshal(got.Config, &config)
+	for index, layer := range got.Layers {
+		content := readAll(t, layer.Open)
+		if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content)); digest != layer.Descriptor.Digest || digest != config.RootFS.DiffIDs[index] {
+			t.Fatalf("layer %d: unexpected digest %s", index, digest)
+		}
+	}
+
+	// converted OCI layout is read back with the same images
+	dir := t.TempDir()
+	if err := WriteOCI(dir, source.Images...); err != nil {
+		t.Fatal(err)
+	}
+	layout, err := OpenSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layout.Close()
+	if layout.Format != FormatOCI || len(layout.Images) != 1 {
+		t.Fatalf("unexpected layout: %s with %d images", layout.Format, len(layout.Images))
+	}
+	if converted := layout.Images[0]; !bytes.Equal(converted.Manifest, got.Manifest) || converted.RepoTags[0] != "alpine:3" {
+		t.Fatalf("unexpected converted image: %+v", converted)
+	}
+	if images := layout.Select("linux/arm64"); len(images) != 0 {
+		t.Fatalf("unexpected images of linux/arm64: %d", len(images))
+	}
+}
+
+func TestOpenSourceRepositories(t *testing.T) {
+	image := testImage(t, "alpine:3", "base")
+	dir := t.TempDir()
+	if err := WriteDocker(dir, image); err != nil {
+		t.Fatal(err)
+	}
+
+	// names are taken from repositories if manifest.json has none
+	var manifests []map[string]any
+	content, _ := os.ReadFile(filepath.Join(dir, ManifestJson))
+	json.Unmarshal(content, &manifests)
+	delete(manifests[0], "RepoTags")
+	content, _ = json.Marshal(manifests)
+	os.WriteFile(filepath.Join(dir, ManifestJson), content, 0o644)
+
+	source, err := OpenSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := source.Images[0].RepoTags; len(tags) != 1 || tags[0] != "alpine:3" {
+		t.Fatalf("unexpected repo tags: %v", tags)
+	}
+
+	// legacy archive has repositories only
+	os.Remove(filepath.Join(dir, ManifestJson))
+	legacy, err := OpenSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := legacy.Images[0]
+	var config imageConfig
+	if err := json.Unmarshal(got.Config, &config); err != nil {
+		t.Fatal(err)
+	}
+	var want imageConfig
+	json.Unmarshal(image.Config, &want)
+	if fmt.Sprint(config.RootFS.DiffIDs) != fmt.Sprint(want.RootFS.DiffIDs) || got.RepoTags[0] != "alpine:3" || got.Platform.String() != "linux/amd64" {
+		t.Fatalf("unexpected legacy image: %s", got.Config)
+	}
+}
+
+func TestOpenSourceUnknown(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "empty.tar")
+	f, _ := os.Create(output)
+	tw := tar.NewWriter(f)
+	tw.WriteHeader(&tar.Header{Name: "file", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	f.Close()
+
+	if _, err := OpenSource(output); !errors.Is(err, ErrUnknownSource) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOpenSourceOutsideLayout(t *testing.T) {
+	// files outside of layouts are valid, but they must not be read
+	root := t.TempDir()
+	image := testImage(t, "alpine:3", "base")
+	image.Manifest = []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	os.WriteFile(filepath.Join(root, "secret.json"), image.Config, 0o644)
+	os.MkdirAll(filepath.Join(root, "oci"), 0o755)
+	os.WriteFile(filepath.Join(root, "oci", "secret.json"), image.Manifest, 0o644)
+
+	// names of manifest.json can't point outside of the directory
+	dir := filepath.Join(root, "docker")
+	if err := WriteDocker(dir, image); err != nil {
+		t.Fatal(err)
+	}
+	var manifests []map[string]any
+	content, _ := os.ReadFile(filepath.Join(dir, ManifestJson))
+	json.Unmarshal(content, &manifests)
+	manifests[0]["Config"] = "../secret.json"
+	content, _ = json.Marshal(manifests)
+	os.WriteFile(filepath.Join(dir, ManifestJson), content, 0o644)
+	if _, err := OpenSource(dir); err == nil {
+		t.Fatal("expected error of config outside of directory")
+	}
+
+	// digests of index.json aren't used as paths unless they are valid
+	dir = filepath.Join(root, "oci", "layout")
+	if err := WriteOCI(dir, image); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, IndexJson))
+	var index map[string]any
+	json.Unmarshal(content, &index)
+	index["manifests"].([]any)[0].(map[string]any)["digest"] = "sha256:../../../secret.json"
+	content, _ = json.Marshal(index)
+	os.WriteFile(filepath.Join(dir, IndexJson), content, 0o644)
+	if _, err := OpenSource(dir); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("expected blob not found, got %v", err)
+	}
+}
+
+// writeBaselineArchive write image to dir in format of archives written by old versions, whose
+// layer.tar are gzip layers as downloaded
+func writeBaselineArchive(t *testing.T, dir string, image *Image) {
+	t.Helper()
+
+	var (
+		parent string
+		layers []string
+		config map[string]any
+	)
+	json.Unmarshal(image.Config, &config)
+	for index, layer := range image.Layers {
+		id := fmt.Sprintf("%x", sha256.Sum256([]byte(parent+layer.Descriptor.Digest)))
+		v1 := map[string]any{"id": id, "created": "2024-01-01T00:00:00Z"}
+		if parent != "" {
+			v1["parent"] = parent
+		}
+		if index == len(image.Layers)-1 {
+			v1["architecture"], v1["os"], v1["config"] = config["architecture"], config["os"], config["config"]
+		}
+		content, _ := json.Marshal(v1)
+		os.MkdirAll(filepath.Join(dir, id), 0o755)
+		os.WriteFile(filepath.Join(dir, id, "VERSION"), []byte("1.0"), 0o644)
+		os.WriteFile(filepath.Join(dir, id, LayerJson), content, 0o644)
+		os.WriteFile(filepath.Join(dir, id, LayerTar), readAll(t, layer.Open), 0o644)
+		layers = append(layers, id+"/"+LayerTar)
+		parent = id
+	}
+
+	configName := fmt.Sprintf("%x.json", sha256.Sum256(image.Config))
+	os.WriteFile(filepath.Join(dir, configName), image.Config, 0o644)
+	manifests, _ := json.Marshal([]http.RootManifest{{Config: configName, RepoTags: image.RepoTags, Layers: layers}})
+	os.WriteFile(filepath.Join(dir, ManifestJson), manifests, 0o644)
+	os.WriteFile(filepath.Join(dir, Repositories), []byte(fmt.Sprintf(`{"alpine":{"3":"%s"}}`, parent)), 0o644)
+}
+
+func TestOpenSourceCompressedLayers(t *testing.T) {
+	image := testImage(t, "alpine:3", "base", "app")
+	dir := t.TempDir()
+	writeBaselineArchive(t, dir, image)
+	output := filepath.Join(t.TempDir(), "alpine.tar.gz")
+	if err := compress.Build(dir, output); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := OpenSource(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	got := source.Images[0]
+	for index, layer := range got.Layers {
+		if want := image.Layers[index].Descriptor; layer.Descriptor.Digest != want.Digest || layer.Descriptor.MediaType != want.MediaType {
+			t.Fatalf("layer %d: got %+v, want %+v", index, layer.Descriptor, want)
+		}
+	}
+	// layers are verified with digests of manifest when they are written
+	if err := WriteOCI(t.TempDir(), got); err != nil {
+		t.Fatal(err)
+	}
+
+	// diff ids of legacy archive are computed from decompressed layers
+	os.Remove(filepath.Join(dir, ManifestJson))
+	legacy, err := OpenSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config, want imageConfig
+	json.Unmarshal(legacy.Images[0].Config, &config)
+	json.Unmarshal(image.Config, &want)
+	if fmt.Sprint(config.RootFS.DiffIDs) != fmt.Sprint(want.RootFS.DiffIDs) {
+		t.Fatalf("got diff ids %v, want %v", config.RootFS.DiffIDs, want.RootFS.DiffIDs)
+	}
+	if err := WriteOCI(t.TempDir(), legacy.Images[0]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// parsePositional parse flags before and after the only positional argument
+func parsePositional(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return positional[0], nil
+}
+
+// parseArgs parse flags before, between and after n positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 || len(positional) == n {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < n {
+		fs.Usage()
+		return nil, errors.New("missing argument")
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	return positional, nil
+}
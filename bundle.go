@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoyah/downer/core"
+)
+
+// runBundle pull images into air-gap bundle with checksums and load script,
+// `downer bundle apply` rebuilds complete images from delta bundle
+func runBundle(args []string) error {
+	if len(args) > 0 && args[0] == "apply" {
+		return runBundleApply(args[1:])
+	}
+
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	var images stringsFlag
+	fs.Var(&images, "image", "--image nginx:alpine, can be repeated")
+	imageList := fs.String("image-list", "", "--image-list ./images.txt")
+	output := fs.String("output", "", "--output ./bundle, directory of bundle")
+	fs.StringVar(output, "o", "", "shorthand of --output")
+	arch := fs.String("arch", "linux/amd64", "--arch linux/amd64")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	cacheDir := fs.String("cache-dir", "", "--cache-dir ~/.cache/downer")
+	noCache := fs.Bool("no-cache", false, "--no-cache")
+	offline := fs.Bool("offline", false, "--offline")
+	format := fs.String("format", "", "--format docker|oci-archive, default is docker, or oci-archive for delta bundle")
+	compression := fs.String("compression", "", "--compression none|gzip|zstd")
+	level := fs.Int("compression-level", 0, "--compression-level 1-9 for gzip, 1-22 for zstd")
+	splitSize := fs.String("split-size", "", "--split-size 2G")
+	sign := fs.String("sign", "", "--sign <gpg key>, sign SHA256SUMS with gpg")
+	since := fs.String("since", "", "--since ./previous/bundle.json, leave out layers in baseline bundle or digest list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *imageList != "" {
+		list, err := readImageList(*imageList)
+		if err != nil {
+			return err
+		}
+		images = append(images, list...)
+	}
+
+	_, err := core.Bundle(&core.BundleConfig{
+		Config: core.Config{
+			Arch:             *arch,
+			Images:           images,
+			Proxy:            *proxy,
+			Debug:            *verbose,
+			CacheDir:         *cacheDir,
+			NoCache:          *noCache,
+			Offline:          *offline,
+			Format:           *format,
+			Compression:      *compression,
+			CompressionLevel: *level,
+			SplitSize:        *splitSize,
+		},
+		Dir:     *output,
+		SignKey: *sign,
+		Since:   *since,
+	})
+	return err
+}
+
+// runBundleApply merge delta bundle with baseline bundle into bundle of complete images
+func runBundleApply(args []string) error {
+	fs := flag.NewFlagSet("bundle apply", flag.ExitOnError)
+	base := fs.String("base", "", "--base ./previous, directory of baseline bundle")
+	output := fs.String("output", "", "--output ./bundle, directory of rebuilt bundle")
+	fs.StringVar(output, "o", "", "shorthand of --output")
+	format := fs.String("format", "docker", "--format docker|oci-archive")
+	compression := fs.String("compression", "", "--compression none|gzip|zstd")
+	level := fs.Int("compression-level", 0, "--compression-level 1-9 for gzip, 1-22 for zstd")
+	sign := fs.String("sign", "", "--sign <gpg key>, sign SHA256SUMS with gpg")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer bundle apply <delta bundle> --base <baseline bundle> -o <bundle>")
+		fs.PrintDefaults()
+	}
+	delta, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+	if *base == "" {
+		fs.Usage()
+		return errors.New("missing --base")
+	}
+
+	_, err = core.ApplyBundle(&core.ApplyConfig{
+		Delta:            delta,
+		Base:             *base,
+		Dir:              *output,
+		Format:           *format,
+		Compression:      *compression,
+		CompressionLevel: *level,
+		SignKey:          *sign,
+		Out:              os.Stdout,
+	})
+	return err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/core"
+	"github.com/anoyah/downer/tools"
+)
+
+const cacheUsage = `usage: downer cache <command> [flags]
+
+commands:
+  ls      list cached images, or blobs with --blobs
+  du      show disk usage of cache
+  prune   remove old images and blobs, or evict blobs beyond size cap
+  gc      remove blobs which aren't referenced by any cached image`
+
+var cacheCommands = map[string]func(store *cache.Store, args []string) error{
+	"ls":    runCacheList,
+	"du":    runCacheUsage,
+	"prune": runCachePrune,
+	"gc":    runCacheGC,
+}
+
+// runCache manage blob cache
+func runCache(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		return errors.New("missing cache command")
+	}
+
+	command, ok := cacheCommands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		return fmt.Errorf("unknown cache command: %s", args[0])
+	}
+
+	// --cache-dir is shared by all cache commands, leave the other flags to subcommand
+	var cacheDir string
+	rest := make([]string, 0, len(args))
+	for index := 1; index < len(args); index++ {
+		arg := args[index]
+		if value, ok := strings.CutPrefix(arg, "--cache-dir="); ok {
+			cacheDir = value
+			continue
+		}
+		if arg == "--cache-dir" && index+1 < len(args) {
+			cacheDir = args[index+1]
+			index++
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	return command(store, rest)
+}
+
+func runCacheList(store *cache.Store, args []string) error {
+	fs := flag.NewFlagSet("cache ls", flag.ExitOnError)
+	blobs := fs.Bool("blobs", false, "--blobs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if *blobs {
+		list, err := store.Blobs()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "DIGEST\tSIZE\tLAST ACCESS")
+		for _, blob := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", blob.Digest, tools.HumanSize(blob.Size), blob.LastAccess.Format(time.DateTime))
+		}
+		return nil
+	}
+
+	refs, err := store.Refs()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "IMAGE\tDIGEST\tPLATFORMS\tSIZE\tUPDATED")
+	for _, ref := range refs {
+		platforms := make([]string, 0, len(ref.Platforms))
+		for platform := range ref.Platforms {
+			platforms = append(platforms, platform)
+		}
+		sort.Strings(platforms)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			ref.Reference(),
+			shortDigest(ref.Digest),
+			strings.Join(platforms, ","),
+			tools.HumanSize(store.Size(ref)),
+			ref.Updated.Format(time.DateTime),
+		)
+	}
+
+	return nil
+}
+
+func runCacheUsage(store *cache.Store, args []string) error {
+	fs := flag.NewFlagSet("cache du", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	usage, err := store.Usage()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("cache: %s\n", store.Root())
+	fmt.Printf("images: %d\n", usage.Refs)
+	fmt.Printf("blobs: %d\n", usage.Blobs)
+	fmt.Printf("size: %s\n", tools.HumanSize(usage.Size))
+	fmt.Printf("unreferenced: %s\n", tools.HumanSize(usage.Unreferenced))
+	return nil
+}
+
+func runCachePrune(store *cache.Store, args []string) error {
+	fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	olderThan := fs.String("older-than", "", "--older-than 30d")
+	keepImages := fs.String("keep-images", "", "--keep-images nginx:alpine,neosmemo/memos:stable")
+	maxSize := fs.String("max-size", "", "--max-size 50G")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan == "" && *keepImages == "" && *maxSize == "" {
+		return errors.New("one of --older-than, --keep-images and --max-size is required")
+	}
+
+	if *olderThan != "" {
+		age, err := tools.ParseDuration(*olderThan)
+		if err != nil {
+			return err
+		}
+		refs, blobs, err := store.PruneOlderThan(age)
+		printPruned(refs, blobs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *keepImages != "" {
+		keep := make(map[string]struct{})
+		for _, image := range strings.Split(*keepImages, ",") {
+			if image = strings.TrimSpace(image); image != "" {
+				name, tag, err := core.NormalizeName(image)
+				if err != nil {
+					return err
+				}
+				keep[name+":"+tag] = struct{}{}
+			}
+		}
+		refs, blobs, err := store.KeepOnly(func(ref *cache.Ref) bool {
+			_, ok := keep[ref.Reference()]
+			return ok
+		})
+		printPruned(refs, blobs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *maxSize != "" {
+		size, err := tools.ParseSize(*maxSize)
+		if err != nil {
+			return err
+		}
+		blobs, err := store.Evict(size)
+		printPruned(nil, blobs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runCacheGC(store *cache.Store, args []string) error {
+	fs := flag.NewFlagSet("cache gc", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	blobs, err := store.GC()
+	printPruned(nil, blobs)
+	return err
+}
+
+func printPruned(refs []*cache.Ref, blobs []cache.Blob) {
+	for _, ref := range refs {
+		fmt.Printf("untagged: %s\n", ref.Reference())
+	}
+
+	var size int64
+	for _, blob := range blobs {
+		fmt.Printf("deleted: %s\n", blob.Digest)
+		size += blob.Size
+	}
+	fmt.Printf("reclaimed space: %s\n", tools.HumanSize(size))
+}
+
+func shortDigest(digest string) string {
+	_, hex, _ := strings.Cut(digest, ":")
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return hex
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	BLOBS  = "blobs"
+	LOCKS  = "locks"
+	SHA256 = "sha256"
+)
+
+var (
+	// ErrInvalidDigest digest isn't `sha256:<hex>`
+	ErrInvalidDigest = errors.New("invalid digest")
+	// ErrDigestMismatch content doesn't match the expected digest
+	ErrDigestMismatch = errors.New("digest mismatch")
+)
+
+// Store content-addressable blob store shared by all downer processes, layout is
+// `<root>/blobs/sha256/<hex>`
+type Store struct {
+	root string
+}
+
+// DefaultDir return `~/.cache/downer` or the cache directory of platform
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "downer"), nil
+}
+
+// Open create store with root, use DefaultDir if root is empty
+func Open(root string) (*Store, error) {
+	if root == "" {
+		dir, err := DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		root = dir
+	}
+
+	for _, dir := range []string{filepath.Join(root, BLOBS, SHA256), filepath.Join(root, LOCKS)} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Store{root: root}, nil
+}
+
+// Root return root directory of store
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Path return path of blob with digest
+func (s *Store) Path(digest string) (string, error) {
+	hexDigest, err := parseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, BLOBS, SHA256, hexDigest), nil
+}
+
+// Has check whether blob with digest is cached
+func (s *Store) Has(digest string) bool {
+	path, err := s.Path(digest)
+	if err != nil {
+		return false
+	}
+
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// Open open cached blob for reading
+func (s *Store) Open(digest string) (*os.File, error) {
+	path, err := s.Path(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+// Write save blob produced by fetch when it isn't cached. Content is verified against
+// digest and renamed into place atomically, and concurrent writers of the same digest
+// are serialized by file lock, so fetch is called at most once across processes.
+func (s *Store) Write(digest string, fetch func(w io.Writer) error) (cached bool, err error) {
+	path, err := s.Path(digest)
+	if err != nil {
+		return false, err
+	}
+
+	unlock, err := s.Lock(digest)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if s.Has(digest) {
+		s.touch(path)
+		return true, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	if err = fetch(io.MultiWriter(tmp, hash)); err != nil {
+		return false, err
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != filepath.Base(path) {
+		err = fmt.Errorf("%w: want %s, got sha256:%s", ErrDigestMismatch, digest, got)
+		return false, err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return false, err
+	}
+	if err = tmp.Close(); err != nil {
+		return false, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Lock acquire exclusive lock of digest which is shared between processes
+func (s *Store) Lock(digest string) (func(), error) {
+	hexDigest, err := parseDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.lock(hexDigest)
+}
+
+func (s *Store) lock(name string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.root, LOCKS, name+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// CopyTo hard link cached blob to dst, fallback to copy if linking isn't supported
+func (s *Store) CopyTo(digest, dst string) error {
+	path, err := s.Path(digest)
+	if err != nil {
+		return err
+	}
+
+	s.touch(path)
+	if err := os.Link(path, dst); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, src); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// touch update modification time of blob which is used as last access time by eviction
+func (s *Store) touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+func parseDigest(digest string) (string, error) {
+	hexDigest, ok := strings.CutPrefix(digest, SHA256+":")
+	if !ok || len(hexDigest) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDigest, digest)
+	}
+	if _, err := hex.DecodeString(hexDigest); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDigest, digest)
+	}
+
+	return hexDigest, nil
+}
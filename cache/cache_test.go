@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func digestOf(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func TestStoreWrite(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("layer content")
+	digest := digestOf(content)
+
+	var fetched atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Write(digest, func(w io.Writer) error {
+				fetched.Add(1)
+				_, err := w.Write(content)
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetched.Load() != 1 {
+		t.Fatalf("fetched %d times", fetched.Load())
+	}
+	if !store.Has(digest) {
+		t.Fatal("blob isn't cached")
+	}
+
+	dst := t.TempDir() + "/layer.tar"
+	if err := store.CopyTo(digest, dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || string(got) != string(content) {
+		t.Fatalf("unexpected content: %s, %v", got, err)
+	}
+}
+
+func TestStoreWriteMismatch(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := digestOf([]byte("expected"))
+	_, err = store.Write(digest, func(w io.Writer) error {
+		_, err := w.Write([]byte("tampered"))
+		return err
+	})
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.Has(digest) {
+		t.Fatal("mismatched blob is cached")
+	}
+}
+
+func TestStoreLocations(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := digestOf([]byte("layer"))
+	for _, repo := range []string{"team-a/app", "team-b/app", "team-a/app"} {
+		if err := store.AddLocation("registry.local:5000", repo, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := store.Locations("registry.local:5000", digest); len(got) != 2 || got[0] != "team-b/app" || got[1] != "team-a/app" {
+		t.Fatalf("unexpected locations: %v", got)
+	}
+	if got := store.Locations("other.local", digest); len(got) != 0 {
+		t.Fatalf("unexpected locations of other registry: %v", got)
+	}
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const gcLock = "gc"
+
+// GracePeriod blobs accessed within it are never removed by gc and prune,
+// they may belong to a pull whose ref isn't recorded yet
+var GracePeriod = time.Hour
+
+type (
+	// Blob cached blob, LastAccess is updated whenever blob is used by a pull
+	Blob struct {
+		Digest     string
+		Size       int64
+		LastAccess time.Time
+	}
+
+	// Usage disk usage of store
+	Usage struct {
+		Refs  int
+		Blobs int
+		Size  int64
+		// Unreferenced size of blobs which aren't referenced by any ref
+		Unreferenced int64
+	}
+
+	// manifestRefs fields of index and manifest referring other blobs
+	manifestRefs struct {
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+		Config *struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+)
+
+// Blobs list all cached blobs sorted by last access, the oldest first
+func (s *Store) Blobs() ([]Blob, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, BLOBS, SHA256))
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make([]Blob, 0, len(entries))
+	for _, entry := range entries {
+		// skip temporary files of writers in progress
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		blobs = append(blobs, Blob{
+			Digest:     SHA256 + ":" + entry.Name(),
+			Size:       fi.Size(),
+			LastAccess: fi.ModTime(),
+		})
+	}
+
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].LastAccess.Before(blobs[j].LastAccess)
+	})
+
+	return blobs, nil
+}
+
+// Referenced return digests of all blobs reachable from ref, including manifests
+func (s *Store) Referenced(refs ...*Ref) map[string]struct{} {
+	marked := make(map[string]struct{})
+	for _, ref := range refs {
+		s.mark(ref.Digest, marked)
+		for _, digest := range ref.Platforms {
+			s.mark(digest, marked)
+		}
+	}
+
+	return marked
+}
+
+// mark digest of manifest and blobs referred by it
+func (s *Store) mark(digest string, marked map[string]struct{}) {
+	if _, ok := marked[digest]; ok {
+		return
+	}
+	marked[digest] = struct{}{}
+
+	path, err := s.Path(digest)
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var manifest manifestRefs
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return
+	}
+	for _, item := range manifest.Manifests {
+		s.mark(item.Digest, marked)
+	}
+	if manifest.Config != nil {
+		marked[manifest.Config.Digest] = struct{}{}
+	}
+	for _, layer := range manifest.Layers {
+		marked[layer.Digest] = struct{}{}
+	}
+}
+
+// Size return total size of cached blobs reachable from ref
+func (s *Store) Size(ref *Ref) int64 {
+	var size int64
+	for digest := range s.Referenced(ref) {
+		path, err := s.Path(digest)
+		if err != nil {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			size += fi.Size()
+		}
+	}
+
+	return size
+}
+
+// Usage summarize disk usage of store
+func (s *Store) Usage() (*Usage, error) {
+	refs, err := s.Refs()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := s.Blobs()
+	if err != nil {
+		return nil, err
+	}
+
+	marked := s.Referenced(refs...)
+	usage := &Usage{Refs: len(refs), Blobs: len(blobs)}
+	for _, blob := range blobs {
+		usage.Size += blob.Size
+		if _, ok := marked[blob.Digest]; !ok {
+			usage.Unreferenced += blob.Size
+		}
+	}
+
+	return usage, nil
+}
+
+// GC mark blobs reachable from recorded refs and sweep the others
+func (s *Store) GC() ([]Blob, error) {
+	unlock, err := s.lock(gcLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	refs, err := s.Refs()
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := s.Blobs()
+	if err != nil {
+		return nil, err
+	}
+
+	marked := s.Referenced(refs...)
+	var candidates []Blob
+	for _, blob := range blobs {
+		if _, ok := marked[blob.Digest]; !ok && !inGracePeriod(blob) {
+			candidates = append(candidates, blob)
+		}
+	}
+
+	return s.remove(candidates, -1)
+}
+
+// PruneOlderThan remove refs updated and blobs accessed before age, which must be positive as
+// age of zero or less would remove everything
+func (s *Store) PruneOlderThan(age time.Duration) ([]*Ref, []Blob, error) {
+	if age <= 0 {
+		return nil, nil, fmt.Errorf("age must be positive: %s", age)
+	}
+	deadline := time.Now().Add(-age)
+
+	refs, err := s.Refs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var removedRefs []*Ref
+	for _, ref := range refs {
+		if ref.Updated.Before(deadline) {
+			if err := s.DeleteRef(ref); err != nil {
+				return removedRefs, nil, err
+			}
+			removedRefs = append(removedRefs, ref)
+		}
+	}
+
+	unlock, err := s.lock(gcLock)
+	if err != nil {
+		return removedRefs, nil, err
+	}
+	defer unlock()
+
+	blobs, err := s.Blobs()
+	if err != nil {
+		return removedRefs, nil, err
+	}
+	var candidates []Blob
+	for _, blob := range blobs {
+		if blob.LastAccess.Before(deadline) && !inGracePeriod(blob) {
+			candidates = append(candidates, blob)
+		}
+	}
+
+	removed, err := s.remove(candidates, -1)
+	return removedRefs, removed, err
+}
+
+// KeepOnly remove refs which aren't matched by keep, then sweep blobs by gc
+func (s *Store) KeepOnly(keep func(*Ref) bool) ([]*Ref, []Blob, error) {
+	refs, err := s.Refs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var removedRefs []*Ref
+	for _, ref := range refs {
+		if keep(ref) {
+			continue
+		}
+		if err := s.DeleteRef(ref); err != nil {
+			return removedRefs, nil, err
+		}
+		removedRefs = append(removedRefs, ref)
+	}
+
+	removed, err := s.GC()
+	return removedRefs, removed, err
+}
+
+// Evict remove least recently used blobs until total size isn't greater than maxSize. Blobs of keep,
+// such as blobs of current pull, are never removed, while the others are removed even if they are
+// accessed within GracePeriod.
+func (s *Store) Evict(maxSize int64, keep ...string) ([]Blob, error) {
+	unlock, err := s.lock(gcLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	blobs, err := s.Blobs()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, blob := range blobs {
+		total += blob.Size
+	}
+	if total <= maxSize {
+		return nil, nil
+	}
+
+	kept := make(map[string]struct{}, len(keep))
+	for _, digest := range keep {
+		kept[digest] = struct{}{}
+	}
+	candidates := make([]Blob, 0, len(blobs))
+	for _, blob := range blobs {
+		if _, ok := kept[blob.Digest]; !ok {
+			candidates = append(candidates, blob)
+		}
+	}
+
+	return s.remove(candidates, total-maxSize)
+}
+
+// inGracePeriod check whether blob is accessed within GracePeriod
+func inGracePeriod(blob Blob) bool {
+	return blob.LastAccess.After(time.Now().Add(-GracePeriod))
+}
+
+// remove blobs in order until size of removed blobs reaches want, want < 0 means all
+func (s *Store) remove(blobs []Blob, want int64) ([]Blob, error) {
+	var (
+		removed []Blob
+		size    int64
+	)
+	for _, blob := range blobs {
+		if want >= 0 && size >= want {
+			break
+		}
+
+		unlock, err := s.Lock(blob.Digest)
+		if err != nil {
+			return removed, err
+		}
+		path, _ := s.Path(blob.Digest)
+		err = os.Remove(path)
+		unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+
+		removed = append(removed, blob)
+		size += blob.Size
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// putOld put blob and make it look like accessed long time ago
+func putOld(t *testing.T, store *Store, content string) string {
+	digest, err := store.Put([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := store.Path(digest)
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	return digest
+}
+
+func TestStoreGC(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := putOld(t, store, "layer")
+	config := putOld(t, store, "config")
+	manifest := putOld(t, store, fmt.Sprintf(`{"config":{"digest":%q},"layers":[{"digest":%q}]}`, config, layer))
+	index := putOld(t, store, fmt.Sprintf(`{"manifests":[{"digest":%q}]}`, manifest))
+	orphan := putOld(t, store, "orphan")
+
+	err = store.SaveRef(&Ref{Name: "docker.io/library/nginx", Tag: "alpine", Digest: index})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Digest != orphan {
+		t.Fatalf("unexpected removed blobs: %+v", removed)
+	}
+	for _, digest := range []string{layer, config, manifest, index} {
+		if !store.Has(digest) {
+			t.Fatalf("referenced blob %s is removed", digest)
+		}
+	}
+
+	refs, removed, err := store.KeepOnly(func(*Ref) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || len(removed) != 4 {
+		t.Fatalf("unexpected pruned: %d refs, %d blobs", len(refs), len(removed))
+	}
+}
+
+func TestStoreEvict(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldest := putOld(t, store, "0123456789")
+	newer := putOld(t, store, "abcdefghij")
+	path, _ := store.Path(newer)
+	recent := time.Now().Add(-2 * GracePeriod)
+	os.Chtimes(path, recent, recent)
+
+	removed, err := store.Evict(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Digest != oldest {
+		t.Fatalf("unexpected evicted blobs: %+v", removed)
+	}
+	if !store.Has(newer) {
+		t.Fatal("recently used blob is evicted")
+	}
+}
+
+func TestStoreEvictAfterWrite(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// blobs written by previous and current pulls are all accessed within grace period
+	previous, err := store.Put([]byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := store.Put([]byte("abcdefghij"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.Evict(15, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Digest != previous {
+		t.Fatalf("unexpected evicted blobs: %+v", removed)
+	}
+	if !store.Has(current) {
+		t.Fatal("blob of current pull is evicted")
+	}
+}
+
+func TestPruneOlderThanRejectsNonPositiveAge(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := putOld(t, store, "layer")
+
+	for _, age := range []time.Duration{0, -30 * 24 * time.Hour} {
+		if _, _, err := store.PruneOlderThan(age); err == nil {
+			t.Fatalf("expected error for age %s", age)
+		}
+	}
+	if !store.Has(digest) {
+		t.Fatal("blob is removed by rejected prune")
+	}
+}
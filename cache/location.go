@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	LOCATIONS    = "locations"
+	locationLock = "locations"
+)
+
+// AddLocation record that blob exists in repository of registry, which is used to mount
+// blob from it when pushing to another repository of the same registry.
+// Layout is `<root>/locations/<registry>/<hex>` with one repository per line.
+func (s *Store) AddLocation(registry, repository, digest string) error {
+	hexDigest, err := parseDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(locationLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := filepath.Join(s.root, LOCATIONS, filepath.FromSlash(registry), hexDigest)
+	repositories, err := readLines(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, repo := range repositories {
+		if repo == repository {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(repository + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Locations return repositories of registry which blob has been pushed to or found in, the latest first
+func (s *Store) Locations(registry, digest string) []string {
+	hexDigest, err := parseDigest(digest)
+	if err != nil {
+		return nil
+	}
+
+	repositories, _ := readLines(filepath.Join(s.root, LOCATIONS, filepath.FromSlash(registry), hexDigest))
+	for i, j := 0, len(repositories)-1; i < j; i, j = i+1, j-1 {
+		repositories[i], repositories[j] = repositories[j], repositories[i]
+	}
+
+	return repositories
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package cache
+
+import (
+	"os"
+	"time"
+)
+
+// lockFile fallback to lock file beside f which is created exclusively
+func lockFile(f *os.File) error {
+	for {
+		l, err := os.OpenFile(f.Name()+".pid", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			return l.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + ".pid")
+}
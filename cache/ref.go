@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	REFS    = "refs"
+	refExt  = ".json"
+	refLock = "refs"
+)
+
+// Ref records which manifest a tag pointed to when it was pulled, it is the root of gc
+type Ref struct {
+	// Name full name of repository, such as `docker.io/library/nginx`
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	// Digest of manifest the tag points to, it is index digest for multi-platform image
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	// Platforms digest of manifest for each pulled platform, such as `linux/amd64`
+	Platforms map[string]string `json:"platforms,omitempty"`
+	Updated   time.Time         `json:"updated"`
+}
+
+// Reference return `name:tag`
+func (r *Ref) Reference() string {
+	return fmt.Sprintf("%s:%s", r.Name, r.Tag)
+}
+
+// Put save content as blob and return its digest
+func (s *Store) Put(content []byte) (string, error) {
+	digest := fmt.Sprintf("%s:%x", SHA256, sha256.Sum256(content))
+	_, err := s.Write(digest, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+
+	return digest, err
+}
+
+// Get read whole content of blob
+func (s *Store) Get(digest string) ([]byte, error) {
+	path, err := s.Path(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.touch(path)
+
+	return content, nil
+}
+
+// SaveRef record ref, platforms pulled before are kept if the tag still points to the same digest
+func (s *Store) SaveRef(ref *Ref) error {
+	unlock, err := s.lock(refLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := s.refPath(ref.Name, ref.Tag)
+	if old, err := readRef(path); err == nil && old.Digest == ref.Digest {
+		for platform, digest := range old.Platforms {
+			if _, ok := ref.Platforms[platform]; !ok {
+				if ref.Platforms == nil {
+					ref.Platforms = map[string]string{}
+				}
+				ref.Platforms[platform] = digest
+			}
+		}
+	}
+	if ref.Updated.IsZero() {
+		ref.Updated = time.Now()
+	}
+
+	content, err := json.MarshalIndent(ref, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// LoadRef read ref of name and tag
+func (s *Store) LoadRef(name, tag string) (*Ref, error) {
+	return readRef(s.refPath(name, tag))
+}
+
+// DeleteRef remove ref, blobs are removed by next gc
+func (s *Store) DeleteRef(ref *Ref) error {
+	unlock, err := s.lock(refLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(s.refPath(ref.Name, ref.Tag))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Refs list all recorded refs sorted by reference
+func (s *Store) Refs() ([]*Ref, error) {
+	var refs []*Ref
+	root := filepath.Join(s.root, REFS)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, refExt) {
+			return nil
+		}
+
+		ref, err := readRef(path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Reference() < refs[j].Reference()
+	})
+
+	return refs, nil
+}
+
+func (s *Store) refPath(name, tag string) string {
+	return filepath.Join(s.root, REFS, filepath.FromSlash(name), tag+refExt)
+}
+
+func readRef(path string) (*Ref, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ref Ref
+	if err := json.Unmarshal(content, &ref); err != nil {
+		return nil, fmt.Errorf("read ref %s: %w", path, err)
+	}
+
+	return &ref, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+// commands subcommands of downer, pull image when no subcommand given
+var commands = map[string]func(args []string) error{
+	"ratelimit": runRateLimit,
+	"cache":     runCache,
+	"join":      runJoin,
+	"bundle":    runBundle,
+	"copy":      runCopy,
+	"convert":   runConvert,
+	"sync":      runSync,
+	"tags":      runTags,
+	"resolve":   runResolve,
+	"inspect":   runInspect,
+}
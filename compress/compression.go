@@ -0,0 +1,138 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// unknownOS OS field of gzip header which doesn't depend on platform
+const unknownOS = 255
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Valid check compression and level, level 0 means the default level of compression
+func Valid(compression string, level int) error {
+	switch compression {
+	case None:
+		if level != 0 {
+			return fmt.Errorf("compression level can't be used without compression")
+		}
+	case Gzip:
+		if level < 0 || level > gzip.BestCompression {
+			return fmt.Errorf("gzip compression level should be 1-%d, got %d", gzip.BestCompression, level)
+		}
+	case Zstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("zstd compression level should be 1-22, got %d", level)
+		}
+	default:
+		return fmt.Errorf("unsupported compression: %s", compression)
+	}
+
+	return nil
+}
+
+// Extension return file extension of compression, such as `.gz`
+func Extension(compression string) string {
+	switch compression {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// NewWriter return writer compressing to w, gzip is compressed with all cores and
+// the same content always produces the same stream. Closing it flushes compressed
+// stream, w isn't closed.
+func NewWriter(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	if err := Valid(compression, level); err != nil {
+		return nil, err
+	}
+
+	switch compression {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gw, err := pgzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		// no name and timestamp in header, the same as `gzip -n`
+		gw.ModTime = time.Unix(0, 0)
+		gw.OS = unknownOS
+		return gw, nil
+	case Zstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// NewReader return uncompressed stream of r, compression is detected by content
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// IsCompressed check whether header of content is gzip or zstd magic
+func IsCompressed(header []byte) bool {
+	return Detect(header) != None
+}
+
+// Detect return compression of stream by its header
+func Detect(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	}
+	return None
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("downer "), 1<<16)
+	for _, compression := range []string{None, Gzip, Zstd} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, compression, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if compression != None && buf.Len() >= len(content) {
+			t.Fatalf("%s: content isn't compressed", compression)
+		}
+		if IsCompressed(buf.Bytes()) != (compression != None) {
+			t.Fatalf("%s: unexpected detection", compression)
+		}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("%s: content doesn't match", compression)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	cases := []struct {
+		compression string
+		level       int
+		ok          bool
+	}{
+		{Gzip, 0, true},
+		{Gzip, 9, true},
+		{Gzip, 10, false},
+		{Zstd, 19, true},
+		{Zstd, 23, false},
+		{None, 0, true},
+		{None, 1, false},
+		{"xz", 0, false},
+	}
+	for _, c := range cases {
+		if err := Valid(c.compression, c.level); (err == nil) != c.ok {
+			t.Fatalf("%s %d: unexpected error: %v", c.compression, c.level, err)
+		}
+	}
+}
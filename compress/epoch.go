@@ -0,0 +1,22 @@
+package compress
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpoch environment variable of reproducible builds, see https://reproducible-builds.org/specs/source-date-epoch/
+const SourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// Epoch return modification time of entries in archive, which is SOURCE_DATE_EPOCH
+// if it's set to a valid timestamp, otherwise unix epoch
+func Epoch() time.Time {
+	if value := os.Getenv(SourceDateEpoch); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+			return time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	return time.Unix(0, 0).UTC()
+}
@@ -0,0 +1,268 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anoyah/downer/tools"
+)
+
+// PartsSuffix suffix of manifest of split archive, such as `nginx.tar.gz.parts.json`
+const PartsSuffix = ".parts.json"
+
+// ErrPartChecksum part of split archive doesn't match checksum in manifest
+var ErrPartChecksum = errors.New("part checksum mismatch")
+
+type (
+	// Parts manifest of split archive, names of parts are relative to manifest
+	Parts struct {
+		Name     string `json:"name"`
+		Size     int64  `json:"size"`
+		Sha256   string `json:"sha256"`
+		PartSize int64  `json:"partSize"`
+		Parts    []Part `json:"parts"`
+	}
+
+	Part struct {
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		Sha256 string `json:"sha256"`
+	}
+
+	// SplitWriter write stream to numbered parts `<output>.000`, `<output>.001`... with at most
+	// partSize bytes, and manifest of checksums `<output>.parts.json` when closing
+	SplitWriter struct {
+		output   string
+		partSize int64
+		parts    Parts
+		total    hash.Hash
+
+		file *os.File
+		hash hash.Hash
+		size int64
+		// written whether manifest is written, so Remove doesn't remove manifest of others
+		written bool
+	}
+)
+
+// NewSplitWriter create writer of split archive, parts and manifest of previous split archive
+// aren't overwritten
+func NewSplitWriter(output string, partSize int64) (*SplitWriter, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("invalid part size: %d", partSize)
+	}
+	// fail before stream is written, the other parts are checked when they are created
+	for _, name := range []string{output + ".000", output + PartsSuffix} {
+		if _, err := os.Stat(name); err == nil {
+			return nil, fmt.Errorf("%w: %s", tools.ErrFileExist, name)
+		}
+	}
+
+	return &SplitWriter{
+		output:   output,
+		partSize: partSize,
+		parts:    Parts{Name: filepath.Base(output), PartSize: partSize},
+		total:    sha256.New(),
+	}, nil
+}
+
+func (s *SplitWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		if s.file == nil || s.size == s.partSize {
+			if err := s.next(); err != nil {
+				return written, err
+			}
+		}
+
+		chunk := p
+		if remaining := s.partSize - s.size; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := s.file.Write(chunk)
+		s.hash.Write(chunk[:n])
+		s.total.Write(chunk[:n])
+		s.size += int64(n)
+		s.parts.Size += int64(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// next close current part and create the next one
+func (s *SplitWriter) next() error {
+	if err := s.closePart(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%03d", s.output, len(s.parts.Parts))
+	f, err := create(name)
+	if err != nil {
+		return err
+	}
+
+	s.file, s.hash, s.size = f, sha256.New(), 0
+	s.parts.Parts = append(s.parts.Parts, Part{Name: filepath.Base(name)})
+	return nil
+}
+
+func (s *SplitWriter) closePart() error {
+	if s.file == nil {
+		return nil
+	}
+
+	part := &s.parts.Parts[len(s.parts.Parts)-1]
+	part.Size = s.size
+	part.Sha256 = fmt.Sprintf("%x", s.hash.Sum(nil))
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Close close the last part and write manifest
+func (s *SplitWriter) Close() error {
+	if s.file == nil && len(s.parts.Parts) == 0 {
+		// empty stream still has one part
+		if err := s.next(); err != nil {
+			return err
+		}
+	}
+	if err := s.closePart(); err != nil {
+		return err
+	}
+	s.parts.Sha256 = fmt.Sprintf("%x", s.total.Sum(nil))
+
+	content, err := json.MarshalIndent(s.parts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := create(s.output + PartsSuffix)
+	if err != nil {
+		return err
+	}
+	s.written = true
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// create file which doesn't exist
+func create(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: %s", tools.ErrFileExist, name)
+	}
+
+	return f, err
+}
+
+// Remove remove parts and manifest which have been written
+func (s *SplitWriter) Remove() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	for _, part := range s.parts.Parts {
+		os.Remove(filepath.Join(filepath.Dir(s.output), part.Name))
+	}
+	if s.written {
+		os.Remove(s.output + PartsSuffix)
+	}
+}
+
+// Manifest return manifest of parts, which is complete after closing
+func (s *SplitWriter) Manifest() *Parts {
+	return &s.parts
+}
+
+// ReadParts read manifest of split archive
+func ReadParts(path string) (*Parts, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts Parts
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(parts.Parts) == 0 {
+		return nil, fmt.Errorf("%s has no parts", path)
+	}
+	// parts are next to manifest, name of part can't point to another file
+	for _, part := range parts.Parts {
+		if part.Name == "" || part.Name == "." || part.Name == ".." || filepath.Base(part.Name) != part.Name {
+			return nil, fmt.Errorf("invalid part name in %s: %q", path, part.Name)
+		}
+	}
+
+	return &parts, nil
+}
+
+// Verify check size and checksum of every part, dir is the directory of manifest
+func (p *Parts) Verify(dir string) error {
+	for _, part := range p.Parts {
+		f, err := os.Open(filepath.Join(dir, part.Name))
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if got := fmt.Sprintf("%x", hash.Sum(nil)); size != part.Size || got != part.Sha256 {
+			return fmt.Errorf("%w: %s", ErrPartChecksum, part.Name)
+		}
+	}
+
+	return nil
+}
+
+// Join verify parts, then write them to w in order and check checksum of the whole archive
+func Join(manifest string, w io.Writer) error {
+	parts, err := ReadParts(manifest)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(manifest)
+	if err := parts.Verify(dir); err != nil {
+		return err
+	}
+
+	total := sha256.New()
+	for _, part := range parts.Parts {
+		f, err := os.Open(filepath.Join(dir, part.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.MultiWriter(w, total), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if got := fmt.Sprintf("%x", total.Sum(nil)); got != parts.Sha256 {
+		return fmt.Errorf("%w: %s", ErrPartChecksum, parts.Name)
+	}
+
+	return nil
+}
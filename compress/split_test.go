@@ -0,0 +1,104 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/tools"
+)
+
+func TestSplitJoin(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "nginx.tar.gz")
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	sw, err := NewSplitWriter(output, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write in chunks which cross boundary of parts
+	for start := 0; start < len(content); start += 3000 {
+		if _, err := sw.Write(content[start:min(start+3000, len(content))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := ReadParts(output + PartsSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts.Parts) != 3 || parts.Size != int64(len(content)) || parts.Parts[2].Size != 10000-2*4096 {
+		t.Fatalf("unexpected parts: %+v", parts)
+	}
+
+	var joined bytes.Buffer
+	if err := Join(output+PartsSuffix, &joined); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(joined.Bytes(), content) {
+		t.Fatal("joined archive doesn't match")
+	}
+
+	// corrupted part is found before anything is written
+	os.WriteFile(filepath.Join(dir, parts.Parts[1].Name), bytes.Repeat([]byte("x"), 4096), 0o644)
+	joined.Reset()
+	if err := Join(output+PartsSuffix, &joined); !errors.Is(err, ErrPartChecksum) || joined.Len() != 0 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// parts must be in the directory of manifest
+	for _, name := range []string{"../secret", "/etc/passwd", ".."} {
+		manifest := filepath.Join(dir, "crafted"+PartsSuffix)
+		os.WriteFile(manifest, []byte(`{"parts":[{"name":"`+name+`","size":1}]}`), 0o644)
+		if _, err := ReadParts(manifest); err == nil {
+			t.Fatalf("expected error of part %s", name)
+		}
+		os.Remove(manifest)
+	}
+
+	sw.Remove()
+	if matches, _ := filepath.Glob(output + "*"); len(matches) != 0 {
+		t.Fatalf("parts aren't removed: %v", matches)
+	}
+}
+
+func TestSplitWriterExisting(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "nginx.tar.gz")
+
+	sw, err := NewSplitWriter(output, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw.Write([]byte("0123"))
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSplitWriter(output, 4); !errors.Is(err, tools.ErrFileExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// stale part of previous split archive isn't overwritten or removed
+	output = filepath.Join(dir, "alpine.tar")
+	stale := []byte("stale")
+	os.WriteFile(output+".001", stale, 0o644)
+	if sw, err = NewSplitWriter(output, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sw.Write([]byte("01234567")); !errors.Is(err, tools.ErrFileExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sw.Remove()
+	if content, _ := os.ReadFile(output + ".001"); !bytes.Equal(content, stale) {
+		t.Fatalf("stale part is overwritten: %q", content)
+	}
+	if _, err := os.Stat(output + ".000"); !os.IsNotExist(err) {
+		t.Fatalf("part isn't removed: %v", err)
+	}
+}
@@ -2,13 +2,13 @@ package compress
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 )
 
+// Build pack folder to tar.gz
 func Build(dirToTar string, output string) error {
 	// 创建 TAR.GZ 文件
 	tarFile, err := os.Create(output)
@@ -19,14 +19,32 @@ func Build(dirToTar string, output string) error {
 	defer tarFile.Close()
 
 	// 创建 Gzip Writer
-	gzipWriter := gzip.NewWriter(tarFile)
+	gzipWriter, err := NewWriter(tarFile, Gzip, 0)
+	if err != nil {
+		return err
+	}
 	defer gzipWriter.Close()
 
+	return writeTar(dirToTar, gzipWriter)
+}
+
+// Tar pack folder to tar without compression
+func Tar(dirToTar string, output string) error {
+	tarFile, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer tarFile.Close()
+
+	return writeTar(dirToTar, tarFile)
+}
+
+func writeTar(dirToTar string, w io.Writer) error {
 	// 创建 TAR Writer
-	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter := tar.NewWriter(w)
 	defer tarWriter.Close()
 
-	// 遍历当前目录的所有文件和子目录
+	// 遍历当前目录的所有文件和子目录, Walk 按文件名顺序遍历
 	return filepath.Walk(dirToTar, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -50,12 +68,17 @@ func Build(dirToTar string, output string) error {
 			return err
 		}
 
-		// 创建 TAR 文件中的文件头
-		header, err := tar.FileInfoHeader(info, relativePath)
-		if err != nil {
-			return err
+		// 创建 TAR 文件中的文件头, 时间、属主和权限统一, 保证相同内容生成相同的归档
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(relativePath),
+			Size:     info.Size(),
+			Mode:     0o644,
+			ModTime:  Epoch(),
+		}
+		if info.Mode()&0o111 != 0 {
+			header.Mode = 0o755
 		}
-		header.Name = relativePath
 
 		// 将文件头写入 TAR 文件
 		if err := tarWriter.WriteHeader(header); err != nil {
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoyah/downer/core"
+)
+
+// runConvert convert docker-archive, OCI archive or OCI layout to another format
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	output := fs.String("output", "", "--output ./vendor-oci, default is name of input with format")
+	fs.StringVar(output, "o", "", "shorthand of --output")
+	format := fs.String("format", "docker", "--format docker|oci|oci-archive")
+	compression := fs.String("compression", "", "--compression none|gzip|zstd, default is gzip for docker and none for oci-archive")
+	level := fs.Int("compression-level", 0, "--compression-level 1-9 for gzip, 1-22 for zstd")
+	arch := fs.String("arch", "", "--arch linux/amd64, convert one platform only")
+	var tags stringsFlag
+	fs.Var(&tags, "tag", "--tag registry.local/vendor/app:1, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer convert <docker-archive|oci-archive|oci layout> --format oci [-o output]")
+		fs.PrintDefaults()
+	}
+	input, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+
+	saved, err := core.Convert(&core.ConvertConfig{
+		Input:            input,
+		Output:           *output,
+		Format:           *format,
+		Compression:      *compression,
+		CompressionLevel: *level,
+		Arch:             *arch,
+		Tags:             tags,
+		Out:              os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("converted images: %s\n", saved)
+	return nil
+}
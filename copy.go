@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoyah/downer/core"
+)
+
+// runCopy copy image from source registry to destination registry
+func runCopy(args []string) error {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	arch := fs.String("arch", "", "--arch linux/amd64, copy one platform only, all platforms are copied by default")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	limitRate := fs.String("limit-rate", "", "--limit-rate 5M")
+	cacheDir := fs.String("cache-dir", "", "--cache-dir ~/.cache/downer")
+	noCache := fs.Bool("no-cache", false, "--no-cache")
+	srcCreds := fs.String("src-creds", "", "--src-creds user:password, credential of docker login is used by default")
+	destCreds := fs.String("dest-creds", "", "--dest-creds user:password, credential of docker login is used by default")
+	chunkSize := fs.String("chunk-size", "", "--chunk-size 16M, upload blobs larger than it with chunks")
+	var insecure stringsFlag
+	fs.Var(&insecure, "insecure-registry", "--insecure-registry localhost:5000, registry served with plain http, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer copy <source reference or archive> <destination> [flags]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	return core.Copy(&core.CopyConfig{
+		Config: core.Config{
+			Name:        positional[0],
+			Arch:        *arch,
+			Proxy:       *proxy,
+			Debug:       *verbose,
+			LimitRate:   *limitRate,
+			CacheDir:    *cacheDir,
+			NoCache:     *noCache,
+			Credentials: *srcCreds,
+			Insecure:    insecure,
+		},
+		Dest:            positional[1],
+		DestCredentials: *destCreds,
+		ChunkSize:       *chunkSize,
+	})
+}
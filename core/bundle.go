@@ -0,0 +1,348 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+)
+
+const (
+	BundleJson = "bundle.json"
+	SHA256SUMS = "SHA256SUMS"
+	LoadScript = "load.sh"
+
+	bundleVersion = 1
+	bundleArchive = "images"
+)
+
+type (
+	// BundleConfig config of air-gap bundle, images are pulled with Config into Dir
+	BundleConfig struct {
+		Config
+		Dir string
+		// SignKey sign SHA256SUMS with gpg key, SHA256SUMS is plain if it's empty
+		SignKey string
+		// Since bundle.json of baseline or file of digests, layers in baseline are left out of delta bundle
+		Since string
+	}
+
+	// BundleManifest machine-readable content of bundle, which is written to bundle.json
+	BundleManifest struct {
+		Version  int           `json:"version"`
+		Created  time.Time     `json:"created"`
+		Format   string        `json:"format"`
+		Archives []BundleFile  `json:"archives"`
+		Images   []BundleImage `json:"images"`
+		// Since baseline of delta bundle, whose layers in Omitted are left out of archive
+		Since   *BundleBase `json:"since,omitempty"`
+		Omitted []string    `json:"omitted,omitempty"`
+	}
+
+	BundleBase struct {
+		// Name file name of bundle.json or digest list of baseline
+		Name   string `json:"name"`
+		Sha256 string `json:"sha256"`
+	}
+
+	BundleFile struct {
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		Sha256 string `json:"sha256"`
+	}
+
+	BundleImage struct {
+		// Reference pulled reference, such as `docker.io/library/nginx:alpine`
+		Reference string `json:"reference"`
+		Registry  string `json:"registry"`
+		// Repository path of repository in registry, such as `library/nginx`
+		Repository string         `json:"repository"`
+		Tag        string         `json:"tag,omitempty"`
+		RepoTags   []string       `json:"repoTags"`
+		Platform   *http.Platform `json:"platform,omitempty"`
+		// Digest of index or manifest which reference points to
+		Digest string `json:"digest,omitempty"`
+		// ManifestDigest digest of manifest of platform
+		ManifestDigest    string `json:"manifestDigest"`
+		ManifestMediaType string `json:"manifestMediaType,omitempty"`
+		// Size total size of config and compressed layers
+		Size  int64             `json:"size"`
+		Blobs []http.Descriptor `json:"blobs"`
+	}
+)
+
+// Bundle pull images into one archive in directory, with bundle.json, SHA256SUMS and load.sh
+func Bundle(cfg *BundleConfig) (*BundleManifest, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("directory of bundle is required")
+	}
+	if cfg.Format == archive.FormatOCI {
+		return nil, errors.New("bundle requires archive file, use --format docker or oci-archive")
+	}
+
+	config := cfg.Config
+	config.Output = ""
+	var base *BundleBase
+	var exclude map[string]struct{}
+	if cfg.Since != "" {
+		var err error
+		if base, exclude, err = readBaseline(cfg.Since); err != nil {
+			return nil, err
+		}
+		// only OCI layout can leave out layers
+		if config.Format == "" {
+			config.Format = archive.FormatOCIArchive
+		}
+		if config.Format != archive.FormatOCIArchive {
+			return nil, errors.New("delta bundle requires --format oci-archive")
+		}
+	}
+
+	if entries, err := os.ReadDir(cfg.Dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory of bundle isn't empty: %s", cfg.Dir)
+	}
+	if err := os.MkdirAll(cfg.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	d, err := NewDp(&config)
+	if err != nil {
+		return nil, err
+	}
+	d.exclude = exclude
+	output := filepath.Join(cfg.Dir, bundleArchive+".tar"+compress.Extension(d.compression))
+	for _, image := range d.images {
+		image.output = output
+	}
+
+	if err := d.Run(); err != nil {
+		return nil, err
+	}
+
+	manifest, err := d.bundleManifest()
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		manifest.Since = base
+		manifest.Omitted = d.omitted()
+		fmt.Fprintf(d.out, "left out %d layers in baseline\n", len(manifest.Omitted))
+	}
+	if err := writeBundle(cfg.Dir, manifest, cfg.SignKey); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(d.out, "bundle: %s\n", cfg.Dir)
+	fmt.Fprintf(d.out, "you can use `./%s` in bundle to check and load it, or `./%s --registry <host>` to push\n", LoadScript, LoadScript)
+	return manifest, nil
+}
+
+// bundleManifest describe images and archive files written by Run
+func (d *Dp) bundleManifest() (*BundleManifest, error) {
+	manifest := &BundleManifest{
+		Version: bundleVersion,
+		Created: time.Now().UTC().Truncate(time.Second),
+		Format:  d.image.format,
+	}
+
+	for _, file := range d.files {
+		sum, size, err := sha256File(file)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Archives = append(manifest.Archives, BundleFile{Name: filepath.Base(file), Size: size, Sha256: sum})
+	}
+
+	for _, image := range d.images {
+		d.image = image
+		item := BundleImage{
+			Reference:         image.ref.String(),
+			Registry:          image.ref.Registry,
+			Repository:        image.ref.Repository,
+			Tag:               image.tag,
+			RepoTags:          d.repoTags(),
+			Platform:          parsePlatform(image.arch),
+			Digest:            image.indexDigest,
+			ManifestDigest:    image.digest,
+			ManifestMediaType: image.mediaType,
+			Blobs:             image.blobs,
+		}
+		if item.Digest == "" {
+			item.Digest = image.ref.Digest
+		}
+		for _, blob := range image.blobs {
+			item.Size += blob.Size
+		}
+		manifest.Images = append(manifest.Images, item)
+	}
+	d.image = d.images[0]
+
+	return manifest, nil
+}
+
+// writeBundle write bundle.json, load.sh and SHA256SUMS of all files in bundle, sign SHA256SUMS if key is given
+func writeBundle(dir string, manifest *BundleManifest, signKey string) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, BundleJson), content, 0o644); err != nil {
+		return err
+	}
+
+	if err := writeLoadScript(dir, manifest); err != nil {
+		return err
+	}
+
+	sums := make(map[string]string)
+	for _, file := range manifest.Archives {
+		sums[file.Name] = file.Sha256
+	}
+	for _, name := range []string{BundleJson, LoadScript} {
+		sum, _, err := sha256File(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		sums[name] = sum
+	}
+	if err := writeSums(filepath.Join(dir, SHA256SUMS), sums); err != nil {
+		return err
+	}
+
+	if signKey == "" {
+		return nil
+	}
+	cmd := exec.Command("gpg", "--batch", "--yes", "--local-user", signKey, "--armor", "--detach-sign", SHA256SUMS)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sign %s: %w: %s", SHA256SUMS, err, output)
+	}
+
+	return nil
+}
+
+// writeSums write checksums with format of `sha256sum`, sorted by name
+func writeSums(path string, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&content, "%s  %s\n", sums[name], name)
+	}
+
+	return os.WriteFile(path, []byte(content.String()), 0o644)
+}
+
+func sha256File(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), size, nil
+}
+
+var loadScript = template.Must(template.New(LoadScript).Parse(`#!/bin/sh
+# generated by downer bundle, check checksums of bundle then load images to docker,
+# or push them to registry with --registry <host>
+set -eu
+cd "$(dirname "$0")"
+
+registry=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--registry) registry="$2"; shift 2 ;;
+	--registry=*) registry="${1#--registry=}"; shift ;;
+	*) echo "usage: $0 [--registry <host>]" >&2; exit 2 ;;
+	esac
+done
+
+if [ -f {{.Sums}}.asc ]; then
+	gpg --verify {{.Sums}}.asc {{.Sums}}
+fi
+if command -v sha256sum >/dev/null 2>&1; then
+	sha256sum -c {{.Sums}}
+else
+	shasum -a 256 -c {{.Sums}}
+fi
+
+{{- if .Delta}}
+echo "delta bundle can't be loaded alone, rebuild images with: downer bundle apply $(pwd) --base <baseline bundle> -o <bundle>" >&2
+exit 1
+{{- else}}
+cat{{range .Archives}} {{.}}{{end}} | docker load
+{{- end}}
+
+if [ -n "$registry" ]; then
+	:
+{{- range .Tags}}
+	docker tag {{.Source}} "$registry/{{.Target}}"
+	docker push "$registry/{{.Target}}"
+{{- end}}
+fi
+`))
+
+type loadTag struct {
+	Source string
+	Target string
+}
+
+func writeLoadScript(dir string, manifest *BundleManifest) error {
+	var data struct {
+		Sums     string
+		Delta    bool
+		Archives []string
+		Tags     []loadTag
+	}
+	data.Sums = SHA256SUMS
+	data.Delta = manifest.Since != nil
+	for _, file := range manifest.Archives {
+		if strings.HasSuffix(file.Name, compress.PartsSuffix) {
+			continue
+		}
+		data.Archives = append(data.Archives, file.Name)
+	}
+	for _, image := range manifest.Images {
+		for _, repoTag := range image.RepoTags {
+			target := repoTag
+			if index := strings.Index(repoTag, "/"); index >= 0 && strings.ContainsAny(repoTag[:index], ".:") {
+				target = repoTag[index+1:]
+			}
+			data.Tags = append(data.Tags, loadTag{Source: repoTag, Target: target})
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, LoadScript), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := loadScript.Execute(f, data); err != nil {
+		return err
+	}
+	return f.Close()
+}
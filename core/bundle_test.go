@@ -0,0 +1,204 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/cache"
+)
+
+func TestBundle(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nginx := putTestImage(t, store, "nginx", "alpine")
+	putTestImage(t, store, "redis", "7")
+
+	dir := filepath.Join(t.TempDir(), "bundle")
+	manifest, err := Bundle(&BundleConfig{
+		Config: Config{
+			Arch:     "linux/amd64",
+			Images:   []string{"nginx:alpine", "redis:7"},
+			CacheDir: cacheDir,
+			Offline:  true,
+		},
+		Dir: dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Images) != 2 || len(manifest.Archives) != 1 || manifest.Archives[0].Name != "images.tar.gz" {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	image := manifest.Images[0]
+	if image.Reference != "docker.io/library/nginx:alpine" || image.ManifestDigest != nginx.manifest ||
+		len(image.Blobs) != 3 || image.Blobs[0].Digest != nginx.config || image.Size == 0 {
+		t.Fatalf("unexpected image: %+v", image)
+	}
+
+	var saved BundleManifest
+	content, err := os.ReadFile(filepath.Join(dir, BundleJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &saved); err != nil || len(saved.Images) != 2 {
+		t.Fatalf("unexpected %s: %s", BundleJson, content)
+	}
+
+	sums, err := os.ReadFile(filepath.Join(dir, SHA256SUMS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"images.tar.gz", BundleJson, LoadScript} {
+		sum, _, _ := sha256File(filepath.Join(dir, name))
+		if !strings.Contains(string(sums), fmt.Sprintf("%s  %s\n", sum, name)) {
+			t.Fatalf("%s isn't in %s:\n%s", name, SHA256SUMS, sums)
+		}
+	}
+
+	script, err := os.ReadFile(filepath.Join(dir, LoadScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cat images.tar.gz | docker load", `docker push "$registry/redis:7"`} {
+		if !strings.Contains(string(script), want) {
+			t.Fatalf("%q isn't in %s:\n%s", want, LoadScript, script)
+		}
+	}
+
+	if _, err := Bundle(&BundleConfig{Config: Config{Images: []string{"nginx"}, CacheDir: cacheDir, Offline: true}, Dir: dir}); err == nil {
+		t.Fatal("expected error of non-empty directory")
+	}
+}
+
+func TestBundleDelta(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nginx := putTestImage(t, store, "nginx", "alpine")
+	busybox := putTestImage(t, store, "busybox", "1")
+
+	root := t.TempDir()
+	bundleFormat := func(format, dir, since string, images ...string) {
+		t.Helper()
+		_, err := Bundle(&BundleConfig{
+			Config: Config{Arch: "linux/amd64", Images: images, CacheDir: cacheDir, Offline: true, Format: format},
+			Dir:    filepath.Join(root, dir),
+			Since:  since,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := func(dir, since string, images ...string) {
+		t.Helper()
+		bundleFormat("", dir, since, images...)
+	}
+	bundle("base", "", "nginx:alpine")
+	bundle("delta", filepath.Join(root, "base", BundleJson), "nginx:alpine", "busybox:1")
+
+	delta, err := ReadBundle(filepath.Join(root, "delta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta.Since == nil || delta.Format != "oci-archive" || !slices.Equal(delta.Omitted, sortedCopy(nginx.layers)) {
+		t.Fatalf("unexpected delta bundle: %+v", delta)
+	}
+	reader, err := archive.OpenReader(filepath.Join(root, "delta", delta.Archives[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range nginx.layers {
+		if reader.Has("blobs/sha256/" + layer[7:]) {
+			t.Fatalf("layer %s in baseline is written to delta", layer)
+		}
+	}
+	if !reader.Has("blobs/sha256/" + busybox.layers[0][7:]) {
+		t.Fatal("new layer isn't written to delta")
+	}
+	reader.Close()
+
+	// the same images can't be applied without baseline holding omitted layers
+	bundle("empty", "", "busybox:1")
+	if _, err := ApplyBundle(&ApplyConfig{Delta: filepath.Join(root, "delta"), Base: filepath.Join(root, "empty"), Dir: filepath.Join(root, "failed")}); !errors.Is(err, archive.ErrBlobNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	manifest, err := ApplyBundle(&ApplyConfig{
+		Delta: filepath.Join(root, "delta"),
+		Base:  filepath.Join(root, "base"),
+		Dir:   filepath.Join(root, "full"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Since != nil || len(manifest.Images) != 2 {
+		t.Fatalf("unexpected bundle: %+v", manifest)
+	}
+
+	reader, err = archive.OpenReader(filepath.Join(root, "full", manifest.Archives[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	manifests, err := reader.DockerManifest()
+	if err != nil || len(manifests) != 2 || manifests[0].RepoTags[0] != "nginx:alpine" {
+		t.Fatalf("unexpected archive: %+v, %v", manifests, err)
+	}
+	for _, layer := range append(nginx.layers, busybox.layers...) {
+		if _, err := reader.OpenBlob(layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// uncompressed layers of docker baseline can't be written under compressed digests of OCI
+	_, err = ApplyBundle(&ApplyConfig{
+		Delta:  filepath.Join(root, "delta"),
+		Base:   filepath.Join(root, "base"),
+		Dir:    filepath.Join(root, "oci-from-docker"),
+		Format: archive.FormatOCIArchive,
+	})
+	if err == nil || !strings.Contains(err.Error(), "--format docker") {
+		t.Fatalf("expected error of docker baseline, got %v", err)
+	}
+
+	bundleFormat(archive.FormatOCIArchive, "oci-base", "", "nginx:alpine")
+	bundle("oci-delta", filepath.Join(root, "oci-base", BundleJson), "nginx:alpine", "busybox:1")
+	manifest, err = ApplyBundle(&ApplyConfig{
+		Delta:  filepath.Join(root, "oci-delta"),
+		Base:   filepath.Join(root, "oci-base"),
+		Dir:    filepath.Join(root, "oci-full"),
+		Format: archive.FormatOCIArchive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ociReader, err := archive.OpenReader(filepath.Join(root, "oci-full", manifest.Archives[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ociReader.Close()
+	for _, layer := range append(nginx.layers, busybox.layers...) {
+		if !ociReader.Has("blobs/sha256/" + layer[7:]) {
+			t.Fatalf("layer %s isn't in rebuilt OCI archive", layer)
+		}
+	}
+}
+
+func sortedCopy(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
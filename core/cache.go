@@ -0,0 +1,88 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/tools"
+)
+
+// cacheManifest keep manifest in blob cache so it can be found by gc, return its digest
+func (d *Dp) cacheManifest(content []byte) string {
+	if d.cache == nil {
+		return ""
+	}
+
+	digest, err := d.cache.Put(content)
+	if err != nil {
+		d.log.Warnf("cache manifest: %s", err)
+		return ""
+	}
+
+	return digest
+}
+
+// recordRef record pulled tag in blob cache
+func (d *Dp) recordRef() error {
+	if d.cache == nil || d.image.indexDigest == "" || d.image.tag == "" {
+		return nil
+	}
+
+	err := d.cache.SaveRef(&cache.Ref{
+		Name:      d.fullName(),
+		Tag:       d.image.tag,
+		Digest:    d.image.indexDigest,
+		MediaType: d.image.indexMediaType,
+		Platforms: map[string]string{d.image.arch: d.image.digest},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// evictCache evict least recently used blobs if cache exceeds its size cap, manifests and blobs of
+// images pulled by current run are kept
+func (d *Dp) evictCache() error {
+	if d.cache == nil || d.cacheMaxSize <= 0 {
+		return nil
+	}
+
+	var keep []string
+	for _, image := range d.images {
+		keep = append(keep, image.indexDigest, image.digest)
+		for _, blob := range image.blobs {
+			keep = append(keep, blob.Digest)
+		}
+	}
+	evicted, err := d.cache.Evict(d.cacheMaxSize, keep...)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, blob := range evicted {
+		size += blob.Size
+	}
+	if len(evicted) > 0 {
+		fmt.Fprintf(d.out, "evicted %d blobs (%s) from cache\n", len(evicted), tools.HumanSize(size))
+	}
+
+	return nil
+}
+
+// NormalizeName return full name and tag of image as recorded in blob cache,
+// such as `nginx:alpine` -> `docker.io/library/nginx`, `alpine`
+func NormalizeName(image string) (string, string, error) {
+	ref, err := tools.ParseReference(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	return ref.Name(), ref.Tag, nil
+}
+
+// fullName return name of repository with registry, such as `docker.io/library/nginx`
+func (d *Dp) fullName() string {
+	return d.image.ref.Name()
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/tools"
+)
+
+// ConvertConfig config of converting docker-archive, OCI archive or OCI layout to another format
+type ConvertConfig struct {
+	Input string
+	// Output default is name of input with extension of format
+	Output string
+	// Format of output: docker, oci or oci-archive, default is docker
+	Format           string
+	Compression      string
+	CompressionLevel int
+	// Arch convert images of platform only, all images are converted if it's empty
+	Arch string
+	// Tags override name of image in output, which requires single image
+	Tags []string
+	// Out progress, nothing is printed if it's nil
+	Out io.Writer
+}
+
+// Convert write images of local archive or layout to output with format, and return the output
+func Convert(cfg *ConvertConfig) (string, error) {
+	format := cfg.Format
+	if format == "" {
+		format = archive.FormatDocker
+	}
+	if !archive.ValidFormat(format) {
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+	compression := cfg.Compression
+	if compression == "" {
+		compression = compress.None
+		if format == archive.FormatDocker {
+			compression = compress.Gzip
+		}
+	}
+	if err := compress.Valid(compression, cfg.CompressionLevel); err != nil {
+		return "", err
+	}
+	if format == archive.FormatOCI && compression != compress.None {
+		return "", errors.New("OCI layout is a directory and can't be compressed, use --format oci-archive")
+	}
+
+	source, err := archive.OpenSource(cfg.Input)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	images := source.Select(cfg.Arch)
+	if len(images) == 0 {
+		return "", fmt.Errorf("don't found arch: %s", cfg.Arch)
+	}
+	if len(cfg.Tags) > 0 {
+		if len(images) > 1 {
+			return "", errors.New("--tag can only be used with single image")
+		}
+		repoTags := make([]string, 0, len(cfg.Tags))
+		for _, tag := range cfg.Tags {
+			ref, err := tools.ParseReference(tag)
+			if err != nil || ref.Tag == "" {
+				return "", fmt.Errorf("invalid tag: %s", tag)
+			}
+			repoTags = append(repoTags, ref.FamiliarName()+":"+ref.Tag)
+		}
+		images[0].RepoTags = repoTags
+	}
+
+	output := cfg.Output
+	if output == "" {
+		output = convertOutput(cfg.Input, format, compression)
+	}
+	if _, err := os.Stat(output); err == nil && format != archive.FormatOCI {
+		return "", fmt.Errorf("%w: %s", tools.ErrFileExist, output)
+	}
+	out := cfg.Out
+	if out == nil {
+		out = io.Discard
+	}
+	fmt.Fprintf(out, "converting %d images of %s %s to %s\n", len(images), source.Format, cfg.Input, format)
+
+	if format == archive.FormatOCI {
+		return output, archive.WriteOCI(output, images...)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	err = compressTo(f, compression, cfg.CompressionLevel, func(w io.Writer) error {
+		if format == archive.FormatOCIArchive {
+			return archive.StreamOCI(w, images...)
+		}
+		return archive.StreamDocker(w, images...)
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return "", err
+	}
+
+	return output, nil
+}
+
+// convertOutput return name of input with extension of format, such as `vendor.tar` -> `vendor-oci`
+func convertOutput(input, format, compression string) string {
+	name := filepath.Clean(input)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar.zst", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+
+	name += "-" + format
+	if format == archive.FormatOCI {
+		return name
+	}
+	return name + ".tar" + compress.Extension(compression)
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/cache"
+)
+
+// saveTestArchive write test image to docker-archive with offline pull
+func saveTestArchive(t *testing.T) (string, *testImage) {
+	t.Helper()
+
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := putTestImage(t, store, "nginx", "alpine")
+
+	output := filepath.Join(t.TempDir(), "vendor.tar.gz")
+	d, err := NewDp(&Config{Arch: "linux/amd64", Name: "nginx:alpine", Output: output, CacheDir: cacheDir, Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	return output, image
+}
+
+func TestConvert(t *testing.T) {
+	input, _ := saveTestArchive(t)
+
+	output, err := Convert(&ConvertConfig{Input: input, Format: archive.FormatOCI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(input), "vendor-oci"); output != want {
+		t.Fatalf("unexpected output: %s", output)
+	}
+
+	source, err := archive.OpenSource(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if len(source.Images) != 1 || source.Images[0].RepoTags[0] != "nginx:alpine" {
+		t.Fatalf("unexpected images: %+v", source.Images)
+	}
+
+	// OCI layout is converted back to docker-archive with new name
+	back, err := Convert(&ConvertConfig{Input: output, Output: filepath.Join(t.TempDir(), "back.tar"), Tags: []string{"registry.local/nginx:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := archive.OpenSource(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if again.Format != archive.FormatDocker || again.Images[0].RepoTags[0] != "registry.local/nginx:1" {
+		t.Fatalf("unexpected images: %s %+v", again.Format, again.Images[0].RepoTags)
+	}
+}
+
+func TestCopyArchive(t *testing.T) {
+	input, image := saveTestArchive(t)
+	registry := newTestRegistry(t)
+
+	err := Copy(&CopyConfig{
+		Config: Config{Name: input, CacheDir: t.TempDir(), Insecure: []string{registry.host()}},
+		Dest:   registry.host() + "/vendor/nginx:1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// config is kept, layers are pushed uncompressed
+	if !registry.has("vendor/nginx", image.config) {
+		t.Fatal("config isn't pushed")
+	}
+	for _, diffID := range image.diffIDs {
+		if !registry.has("vendor/nginx", diffID) {
+			t.Fatalf("layer %s isn't pushed", diffID)
+		}
+	}
+	if registry.tags["vendor/nginx:1"] == "" {
+		t.Fatal("manifest isn't tagged")
+	}
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+// CopyConfig config of copying image from registry to registry without local archive
+type CopyConfig struct {
+	// Config source image is Name, which is reference or path of docker-archive, OCI archive or
+	// OCI layout, all platforms are copied if Arch is empty
+	Config
+	// Dest destination reference, such as `registry.local/library/nginx:alpine`
+	Dest string
+	// DestCredentials `user:password` of destination registry, credential saved by `docker login` is used if it's empty
+	DestCredentials string
+	// ChunkSize upload blobs larger than it with chunks, such as `16M`, blobs are uploaded monolithically if it's empty
+	ChunkSize string
+}
+
+// Copy pull image with the same client as pulling archive, and push it to destination
+// with distribution API, blobs which exist in destination are skipped
+func Copy(cfg *CopyConfig) error {
+	dest, err := tools.ParseReference(cfg.Dest)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	var chunkSize int64
+	if cfg.ChunkSize != "" {
+		if chunkSize, err = tools.ParseSize(cfg.ChunkSize); err != nil {
+			return err
+		}
+	}
+	if isLocalSource(cfg.Name) {
+		return copyArchive(cfg, dest, chunkSize)
+	}
+	if cfg.Offline {
+		return errors.New("copy requests source registry and can't be used with --offline")
+	}
+
+	config := cfg.Config
+	config.Output = ""
+	d, err := NewDp(&config)
+	if err != nil {
+		return err
+	}
+	if len(d.images) > 1 {
+		return errors.New("copy accepts one source image")
+	}
+
+	clean, err := d.init()
+	if err != nil {
+		return err
+	}
+	defer clean()
+
+	p, err := newPusher(d, dest, cfg.DestCredentials, chunkSize)
+	if err != nil {
+		return err
+	}
+	if err := p.login(); err != nil {
+		return fmt.Errorf("login %s: %w", dest.Registry, err)
+	}
+
+	if err := d.copyTo(p); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(d.out, "copied %s to %s\n", d.image.ref.Familiar(), dest.Familiar())
+	return nil
+}
+
+// copyTo push current image to pusher, manifests of index are pushed before index
+func (d *Dp) copyTo(p *pusher) error {
+	if err := d.authorize(d.image); err != nil {
+		return err
+	}
+
+	content, err := d.refreshToken()
+	if err != nil {
+		return err
+	}
+	mediaType := contentMediaType(d.image.indexMediaType, content)
+
+	if !isManifest(content) && d.image.arch != "" {
+		// copy manifest of one platform only
+		arch2Manifest, err := parseManifests(content)
+		if err != nil {
+			return err
+		}
+		manifest, ok := arch2Manifest[d.image.arch]
+		if !ok {
+			return fmt.Errorf("don't found arch: %s", d.image.arch)
+		}
+		_, content, err = d.getDigestSource(manifest.Digest)
+		if err != nil {
+			return err
+		}
+		mediaType = contentMediaType(manifest.MediaType, content)
+	}
+
+	if isManifest(content) {
+		if err := d.copyManifest(p, content); err != nil {
+			return err
+		}
+	} else {
+		var index http.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return fmt.Errorf("parse index: %w", err)
+		}
+		for _, desc := range index.Manifests {
+			_, manifest, err := d.getDigestSource(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := d.copyManifest(p, manifest); err != nil {
+				return err
+			}
+			if err := p.pushManifest(desc.Digest, contentMediaType(desc.MediaType, manifest), manifest); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.pushManifest(p.ref.Reference(), mediaType, content)
+}
+
+// copyManifest push config and layers of manifest
+func (d *Dp) copyManifest(p *pusher, content []byte) error {
+	blobs, err := manifestBlobs(content)
+	if err != nil {
+		return err
+	}
+
+	image := d.image
+	for _, blob := range blobs {
+		if image.ref.Registry == p.ref.Registry {
+			// blobs of source can be mounted when copying within registry
+			p.locations[blob.Digest] = append(p.locations[blob.Digest], image.ref.Repository)
+		}
+		err := p.pushBlob(blob, func() (io.ReadCloser, error) {
+			return d.openBlob(image, blob.Digest, blob.MediaType)
+		})
+		if err != nil {
+			return fmt.Errorf("push blob %s: %w", blob.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// contentMediaType return media type in header, or the one declared in content
+func contentMediaType(mediaType string, content []byte) string {
+	if mediaType, _, _ = strings.Cut(mediaType, ";"); mediaType != "" && mediaType != "application/json" {
+		return strings.TrimSpace(mediaType)
+	}
+
+	var probe struct {
+		MediaType string `json:"mediaType"`
+	}
+	json.Unmarshal(content, &probe)
+	return probe.MediaType
+}
+
+// isLocalSource check whether name is archive file or OCI layout directory rather than reference
+func isLocalSource(name string) bool {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	if fi.Mode().IsRegular() {
+		return true
+	}
+
+	_, err = os.Stat(filepath.Join(name, archive.IndexJson))
+	return fi.IsDir() && err == nil
+}
+
+// copyArchive push images of docker-archive, OCI archive or OCI layout to destination,
+// images of several platforms are pushed with index
+func copyArchive(cfg *CopyConfig, dest *tools.Reference, chunkSize int64) error {
+	d, err := newRemote(&cfg.Config)
+	if err != nil {
+		return err
+	}
+
+	source, err := archive.OpenSource(cfg.Name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	images := source.Select(cfg.Arch)
+	if len(images) == 0 {
+		return fmt.Errorf("don't found arch: %s", cfg.Arch)
+	}
+
+	var index *http.Index
+	if len(images) > 1 {
+		// images of several platforms are pushed as multi-platform image
+		index = &http.Index{SchemaVersion: 2, MediaType: archive.MediaTypeOCIIndex}
+		seen := make(map[string]struct{})
+		for _, image := range images {
+			if image.Platform == nil {
+				return fmt.Errorf("%s has %d images, select one with --arch", cfg.Name, len(images))
+			}
+			if _, ok := seen[image.Platform.String()]; ok {
+				return fmt.Errorf("%s has several images of %s", cfg.Name, image.Platform)
+			}
+			seen[image.Platform.String()] = struct{}{}
+		}
+	}
+
+	p, err := newPusher(d, dest, cfg.DestCredentials, chunkSize)
+	if err != nil {
+		return err
+	}
+	if err := p.login(); err != nil {
+		return fmt.Errorf("login %s: %w", dest.Registry, err)
+	}
+
+	for _, image := range images {
+		if err := pushImage(p, image, index == nil); err != nil {
+			return err
+		}
+		if index != nil {
+			index.Manifests = append(index.Manifests, http.Descriptor{
+				MediaType: image.ManifestMediaType,
+				Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(image.Manifest)),
+				Size:      int64(len(image.Manifest)),
+				Platform:  image.Platform,
+			})
+		}
+	}
+	if index != nil {
+		content, err := json.Marshal(index)
+		if err != nil {
+			return err
+		}
+		if err := p.pushManifest(dest.Reference(), index.MediaType, content); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(d.out, "copied %s to %s\n", cfg.Name, dest.Familiar())
+	return nil
+}
+
+// pushImage push blobs and manifest of image, manifest is pushed with tag of destination or its digest
+func pushImage(p *pusher, image *archive.Image, tagged bool) error {
+	config := http.Descriptor{
+		MediaType: image.ConfigMediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(image.Config)),
+		Size:      int64(len(image.Config)),
+	}
+	err := p.pushBlob(config, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(image.Config)), nil
+	})
+	if err != nil {
+		return fmt.Errorf("push config %s: %w", config.Digest, err)
+	}
+
+	for _, layer := range image.Layers {
+		if layer.Open == nil {
+			return fmt.Errorf("%w: layer %s", archive.ErrLayerMissing, layer.Descriptor.Digest)
+		}
+		if err := p.pushBlob(layer.Descriptor, layer.Open); err != nil {
+			return fmt.Errorf("push blob %s: %w", layer.Descriptor.Digest, err)
+		}
+	}
+
+	reference := fmt.Sprintf("sha256:%x", sha256.Sum256(image.Manifest))
+	if tagged {
+		reference = p.ref.Reference()
+	}
+	return p.pushManifest(reference, image.ManifestMediaType, image.Manifest)
+}
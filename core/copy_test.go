@@ -0,0 +1,145 @@
+package core
+
+import (
+	"testing"
+)
+
+// seedRegistry put test image into repository of registry with tag
+func seedRegistry(t *testing.T, registry *testRegistry, repo, tag string) *testImage {
+	t.Helper()
+
+	image := buildTestImage(t, repo, func(content []byte) string {
+		return registry.put(repo, content)
+	})
+	registry.tag(repo, tag, image.manifest, "application/vnd.oci.image.manifest.v1+json")
+	registry.tag(repo, tag, image.index, "application/vnd.oci.image.index.v1+json")
+	return image
+}
+
+func copyImage(t *testing.T, source, registry *testRegistry, src, dest, arch, chunkSize string) {
+	t.Helper()
+
+	err := Copy(&CopyConfig{
+		Config: Config{
+			Name:     source.host() + "/" + src,
+			Arch:     arch,
+			CacheDir: t.TempDir(),
+			Insecure: []string{source.host(), registry.host()},
+		},
+		Dest:      registry.host() + "/" + dest,
+		ChunkSize: chunkSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	source := newTestRegistry(t)
+	image := seedRegistry(t, source, "library/src", "1")
+	registry := newTestRegistry(t)
+
+	copyImage(t, source, registry, "library/src:1", "mirror/app:2", "", "")
+
+	if got := registry.tags["mirror/app:2"]; got != image.index {
+		t.Fatalf("tag points to %s, want index %s", got, image.index)
+	}
+	for _, digest := range append([]string{image.index, image.manifest, image.config}, image.layers...) {
+		if !registry.has("mirror/app", digest) {
+			t.Fatalf("%s isn't copied", digest)
+		}
+	}
+	if registry.monolithic != 3 || registry.patches != 0 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d patches", registry.monolithic, registry.patches)
+	}
+
+	// blobs in destination are skipped
+	copyImage(t, source, registry, "library/src:1", "mirror/app:3", "", "")
+	if registry.monolithic != 3 {
+		t.Fatalf("existing blobs are uploaded again: %d", registry.monolithic)
+	}
+	if got := registry.tags["mirror/app:3"]; got != image.index {
+		t.Fatalf("tag points to %s, want index %s", got, image.index)
+	}
+}
+
+func TestCopyChunked(t *testing.T) {
+	source := newTestRegistry(t)
+	image := seedRegistry(t, source, "library/src", "1")
+	registry := newTestRegistry(t)
+
+	copyImage(t, source, registry, "library/src:1", "mirror/app:1", "linux/amd64", "16")
+
+	// one platform is copied as manifest
+	if got := registry.tags["mirror/app:1"]; got != image.manifest {
+		t.Fatalf("tag points to %s, want manifest %s", got, image.manifest)
+	}
+	if registry.has("mirror/app", image.index) {
+		t.Fatal("index is copied with --arch")
+	}
+	for _, digest := range append([]string{image.config}, image.layers...) {
+		if !registry.has("mirror/app", digest) {
+			t.Fatalf("%s isn't copied", digest)
+		}
+	}
+	if registry.monolithic != 0 || registry.patches == 0 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d patches", registry.monolithic, registry.patches)
+	}
+}
+
+func TestCopyMount(t *testing.T) {
+	source := newTestRegistry(t)
+	image := seedRegistry(t, source, "library/src", "1")
+	registry := newTestRegistry(t)
+	registry.auth = true
+
+	copy := func(dest, cacheDir string) {
+		t.Helper()
+		err := Copy(&CopyConfig{
+			Config: Config{
+				Name:     source.host() + "/library/src:1",
+				CacheDir: cacheDir,
+				Insecure: []string{source.host(), registry.host()},
+			},
+			Dest: registry.host() + "/" + dest,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cacheDir := t.TempDir()
+	copy("team-a/app:1", cacheDir)
+	if registry.monolithic != 3 || registry.mounts != 0 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d mounts", registry.monolithic, registry.mounts)
+	}
+
+	// blobs pushed to team-a are mounted with token which is allowed to pull from it
+	copy("team-b/app:1", cacheDir)
+	if registry.monolithic != 3 || registry.mounts != 3 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d mounts", registry.monolithic, registry.mounts)
+	}
+	for _, digest := range append([]string{image.index, image.config}, image.layers...) {
+		if !registry.has("team-b/app", digest) {
+			t.Fatalf("%s isn't copied", digest)
+		}
+	}
+
+	// fallback to upload when mount is refused
+	registry.refuseMount = true
+	copy("team-c/app:1", cacheDir)
+	if registry.monolithic != 6 || registry.mounts != 3 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d mounts", registry.monolithic, registry.mounts)
+	}
+}
+
+func TestCopyMountWithinRegistry(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.auth = true
+	seedRegistry(t, registry, "library/src", "1")
+
+	copyImage(t, registry, registry, "library/src:1", "mirror/app:1", "", "")
+	if registry.monolithic != 0 || registry.mounts != 3 {
+		t.Fatalf("unexpected uploads: %d monolithic, %d mounts", registry.monolithic, registry.mounts)
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anoyah/downer/tools"
+)
+
+// dockerHubAuthKey key of Docker Hub in `auths` of docker config
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// credential username and password sent to token realm, or to registry with basic authentication
+type credential struct {
+	username string
+	password string
+}
+
+// parseCredential parse `user:password`, empty string means anonymous
+func parseCredential(s string) (*credential, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	username, password, ok := strings.Cut(s, ":")
+	if !ok || username == "" {
+		return nil, errors.New("credential should be user:password")
+	}
+
+	return &credential{username: username, password: password}, nil
+}
+
+// lookupCredential return credential given by user, or the one saved by `docker login`
+// in `$DOCKER_CONFIG/config.json`, nil if neither is found
+func lookupCredential(s, registry string) (*credential, error) {
+	if s != "" {
+		return parseCredential(s)
+	}
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil, nil
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("parse docker config: %w", err)
+	}
+
+	key := registry
+	if registry == tools.DefaultRegistry {
+		key = dockerHubAuthKey
+	}
+	for host, auth := range config.Auths {
+		if host != key && strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://") != key {
+			continue
+		}
+		if auth.Username != "" {
+			return &credential{username: auth.Username, password: auth.Password}, nil
+		}
+		if auth.Auth == "" {
+			// saved by credential helper, which isn't supported
+			return nil, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("decode auth of %s in docker config: %w", host, err)
+		}
+		return parseCredential(string(decoded))
+	}
+
+	return nil, nil
+}
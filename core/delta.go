@@ -0,0 +1,325 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/tools"
+)
+
+// ApplyConfig config to rebuild complete images from delta bundle and its baseline
+type ApplyConfig struct {
+	// Delta directory of delta bundle
+	Delta string
+	// Base directory of baseline bundle, which holds every layer left out of delta
+	Base string
+	// Dir directory of rebuilt bundle
+	Dir string
+	// Format of rebuilt archive: docker or oci-archive, default is docker
+	Format           string
+	Compression      string
+	CompressionLevel int
+	SignKey          string
+	// Out progress and warnings, nothing is printed if it's nil
+	Out io.Writer
+}
+
+// readBaseline read digests of blobs in baseline, which is bundle.json or file with one digest per line
+func readBaseline(path string) (*BundleBase, map[string]struct{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum, _, err := sha256File(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digests := make(map[string]struct{})
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		var manifest BundleManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if manifest.Since != nil {
+			return nil, nil, fmt.Errorf("baseline %s is a delta bundle, apply it first", path)
+		}
+		for _, image := range manifest.Images {
+			for _, blob := range image.Blobs {
+				digests[blob.Digest] = struct{}{}
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !strings.HasPrefix(line, "sha256:") || len(line) != len("sha256:")+64 {
+				return nil, nil, fmt.Errorf("invalid digest in %s: %s", path, line)
+			}
+			digests[line] = struct{}{}
+		}
+	}
+
+	return &BundleBase{Name: filepath.Base(path), Sha256: sum}, digests, nil
+}
+
+// omitted return sorted digests of layers left out of archive
+func (d *Dp) omitted() []string {
+	seen := make(map[string]struct{})
+	for _, image := range d.images {
+		for _, blob := range image.blobs[1:] {
+			if _, ok := d.exclude[blob.Digest]; ok {
+				seen[blob.Digest] = struct{}{}
+			}
+		}
+	}
+
+	omitted := make([]string, 0, len(seen))
+	for digest := range seen {
+		omitted = append(omitted, digest)
+	}
+	sort.Strings(omitted)
+	return omitted
+}
+
+// ReadBundle read bundle.json of bundle and check checksums of its archives
+func ReadBundle(dir string) (*BundleManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, BundleJson))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", BundleJson, err)
+	}
+
+	for _, file := range manifest.Archives {
+		sum, _, err := sha256File(filepath.Join(dir, file.Name))
+		if err != nil {
+			return nil, err
+		}
+		if sum != file.Sha256 {
+			return nil, fmt.Errorf("%w: %s", tools.ErrChecksumMismatch, file.Name)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// openBundleArchive open archive of bundle, parts of split archive are joined to temporary file first
+func openBundleArchive(dir string, manifest *BundleManifest) (*archive.Reader, func(), error) {
+	for _, file := range manifest.Archives {
+		if !strings.HasSuffix(file.Name, compress.PartsSuffix) {
+			continue
+		}
+
+		tmp, err := os.CreateTemp("", "downer-join-*")
+		if err != nil {
+			return nil, nil, err
+		}
+		clean := func() { os.Remove(tmp.Name()) }
+		err = compress.Join(filepath.Join(dir, file.Name), tmp)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			clean()
+			return nil, nil, err
+		}
+
+		reader, err := archive.OpenReader(tmp.Name())
+		if err != nil {
+			clean()
+			return nil, nil, err
+		}
+		return reader, func() { reader.Close(); clean() }, nil
+	}
+
+	if len(manifest.Archives) != 1 {
+		return nil, nil, fmt.Errorf("bundle %s should have one archive, got %d", dir, len(manifest.Archives))
+	}
+	reader, err := archive.OpenReader(filepath.Join(dir, manifest.Archives[0].Name))
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, func() { reader.Close() }, nil
+}
+
+// ApplyBundle merge delta bundle with its baseline, and write bundle of complete images to Dir
+func ApplyBundle(cfg *ApplyConfig) (*BundleManifest, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("directory of bundle is required")
+	}
+	format := cfg.Format
+	if format == "" {
+		format = archive.FormatDocker
+	}
+	if format != archive.FormatDocker && format != archive.FormatOCIArchive {
+		return nil, errors.New("bundle requires --format docker or oci-archive")
+	}
+	compression := cfg.Compression
+	if compression == "" {
+		compression = compress.None
+		if format == archive.FormatDocker {
+			compression = compress.Gzip
+		}
+	}
+	if err := compress.Valid(compression, cfg.CompressionLevel); err != nil {
+		return nil, err
+	}
+	out := cfg.Out
+	if out == nil {
+		out = io.Discard
+	}
+	if entries, err := os.ReadDir(cfg.Dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory of bundle isn't empty: %s", cfg.Dir)
+	}
+
+	delta, err := ReadBundle(cfg.Delta)
+	if err != nil {
+		return nil, fmt.Errorf("delta bundle: %w", err)
+	}
+	if delta.Since == nil {
+		return nil, fmt.Errorf("%s isn't a delta bundle", cfg.Delta)
+	}
+	base, err := ReadBundle(cfg.Base)
+	if err != nil {
+		return nil, fmt.Errorf("baseline bundle: %w", err)
+	}
+	if sum, _, err := sha256File(filepath.Join(cfg.Base, BundleJson)); err == nil && delta.Since.Name == BundleJson && sum != delta.Since.Sha256 {
+		fmt.Fprintf(out, "warning: baseline %s isn't the one delta bundle was made with\n", cfg.Base)
+	}
+	if format == archive.FormatOCIArchive && base.Format != archive.FormatOCIArchive {
+		// layers of docker-archive are uncompressed, which don't match compressed digests in OCI manifests
+		return nil, fmt.Errorf("baseline %s is a %s bundle with uncompressed layers, it can only be applied with --format docker", cfg.Base, cmp.Or(base.Format, archive.FormatDocker))
+	}
+
+	deltaReader, closeDelta, err := openBundleArchive(cfg.Delta, delta)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDelta()
+	baseReader, closeBase, err := openBundleArchive(cfg.Base, base)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBase()
+
+	// blobs are taken from delta first, then from baseline
+	openBlob := func(digest string) (io.ReadCloser, error) {
+		r, err := deltaReader.OpenBlob(digest)
+		if errors.Is(err, archive.ErrBlobNotFound) {
+			return baseReader.OpenBlob(digest)
+		}
+		return r, err
+	}
+
+	images := make([]*archive.Image, 0, len(delta.Images))
+	for _, item := range delta.Images {
+		image, err := applyImage(item, openBlob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", item.Reference, err)
+		}
+		images = append(images, image)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	output := filepath.Join(cfg.Dir, bundleArchive+".tar"+compress.Extension(compression))
+	f, err := os.Create(output)
+	if err != nil {
+		return nil, err
+	}
+	err = compressTo(f, compression, cfg.CompressionLevel, func(w io.Writer) error {
+		if format == archive.FormatOCIArchive {
+			return archive.StreamOCI(w, images...)
+		}
+		return archive.StreamDocker(w, images...)
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return nil, err
+	}
+
+	sum, size, err := sha256File(output)
+	if err != nil {
+		return nil, err
+	}
+	manifest := *delta
+	manifest.Format = format
+	manifest.Archives = []BundleFile{{Name: filepath.Base(output), Size: size, Sha256: sum}}
+	manifest.Since, manifest.Omitted = nil, nil
+	if err := writeBundle(cfg.Dir, &manifest, cfg.SignKey); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "rebuilt %d images: %s\n", len(images), cfg.Dir)
+	return &manifest, nil
+}
+
+// applyImage build image from blobs of bundle, layers are opened when archive is written
+func applyImage(item BundleImage, openBlob func(digest string) (io.ReadCloser, error)) (*archive.Image, error) {
+	if len(item.Blobs) == 0 {
+		return nil, errors.New("image has no config")
+	}
+
+	readBlob := func(digest string) ([]byte, error) {
+		r, err := openBlob(digest)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	manifest, err := readBlob(item.ManifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	config, err := readBlob(item.Blobs[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &archive.Image{
+		Config:            config,
+		ConfigMediaType:   item.Blobs[0].MediaType,
+		Manifest:          manifest,
+		ManifestMediaType: item.ManifestMediaType,
+		Platform:          item.Platform,
+		RepoTags:          item.RepoTags,
+	}
+	for _, blob := range item.Blobs[1:] {
+		image.Layers = append(image.Layers, archive.Layer{
+			Descriptor: blob,
+			Open: func() (io.ReadCloser, error) {
+				r, err := openBlob(blob.Digest)
+				if errors.Is(err, archive.ErrBlobNotFound) {
+					return nil, fmt.Errorf("%w: %s isn't in delta nor baseline", archive.ErrBlobNotFound, blob.Digest)
+				}
+				return r, err
+			},
+		})
+	}
+
+	return image, nil
+}
@@ -5,88 +5,147 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	nethttp "net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/cache"
 	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/engine"
 	"github.com/anoyah/downer/http"
 	"github.com/anoyah/downer/tools"
 )
 
-var (
-	arch2Manifest   = map[string]*http.Manifest{}
-	tempDir         = "images"
-	library         = "library"
-	containerConfig = map[string]any{
-		"Hostname":     "",
-		"Domainname":   "",
-		"User":         "",
-		"AttachStdin":  false,
-		"AttachStdout": false,
-		"AttachStderr": false,
-		"Tty":          false,
-		"OpenStdin":    false,
-		"StdinOnce":    false,
-		"Env":          nil,
-		"Cmd":          nil,
-		"Image":        "",
-		"Volumes":      nil,
-		"WorkingDir":   "",
-		"Entrypoint":   nil,
-		"OnBuild":      nil,
-		"Labels":       nil,
-	}
-)
-
 const (
-	registryUrl         = "https://registry-1.docker.io/v2/%s/%s/%s/%s"
-	OutFileTmpl         = "%s-%s-%s.tar.gz"
-	repositoriesContent = `{"%s":{"%s":"%s"}}`
+	registryUrl  = "%s/v2/%s/%s/%s"
+	dockerHubUrl = "https://registry-1.docker.io"
+	OutFileTmpl  = "%s-%s-%s"
 
 	UNKNOWN         = "unknown"
 	WwwAuthenticate = "Www-Authenticate"
-	AcceptRefresh   = "application/vnd.docker.distribution.manifest.v2+json,application/vnd.docker.distribution.manifest.list.v2+json"
-	DefaultTime     = "1970-01-01T08:00:00+08:00"
-	LayerName       = "/layer.tar"
-	Repositories    = "repositories"
-	ManifestJson    = "manifest.json"
+	AcceptRefresh   = "application/vnd.docker.distribution.manifest.v2+json,application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.oci.image.index.v1+json,application/vnd.oci.image.manifest.v1+json"
+	AcceptManifest  = "application/vnd.docker.distribution.manifest.v2+json,application/vnd.oci.image.manifest.v1+json"
 	MANIFESTS       = "manifests"
 	BLOBS           = "blobs"
-	VERSION         = "VERSION"
+
+	// Stdout output to stream archive to standard output
+	Stdout = "-"
 )
 
 type (
 	Dp struct {
 		client *http.Client
 		log    *logger
-		image  *Image
+		// image is the one being resolved, images are all written to the same archive
+		image   *Image
+		images  []*Image
+		cache   *cache.Store
+		tempDir string
+		// files written to output, which are parts and their manifest if archive is split
+		files []string
+		// out progress output, which is stderr when archive is streamed to stdout
+		out io.Writer
+
+		offline      bool
+		cacheMaxSize int64
+
+		compression      string
+		compressionLevel int
+		splitSize        int64
+		// exclude layers which are left out of archive, such as layers in baseline of delta bundle
+		exclude map[string]struct{}
+
+		rateLimit     *http.RateLimit
+		waitRateLimit bool
+
+		// credentials `user:password` of registry, credential saved by `docker login` is used if it's empty
+		credentials string
+		// insecure hosts of registries served with plain http
+		insecure map[string]struct{}
+		// engine Docker daemon which archive is loaded to instead of writing file
+		engine *engine.Client
+		// dryRun print blobs to fetch and disk space needed instead of pulling
+		dryRun bool
+	}
+
+	// imageManifest manifest of image for one platform with its raw content
+	imageManifest struct {
+		*http.Manifest
+		content []byte
+		digest  string
 	}
 
 	Image struct {
+		ref    *tools.Reference
 		name   string
 		tag    string
+		tags   []string
 		arch   string
 		output string
+		format string
+
+		// token and its expiry, which is zero if registry doesn't require token
+		token       string
+		tokenExpiry time.Time
+		// cred sent to registry which issues Basic challenge instead of token
+		cred *credential
+
+		indexDigest    string
+		indexMediaType string
+		// digest of manifest resolved for arch
+		digest    string
+		mediaType string
+		// blobs config and layers of manifest
+		blobs []http.Descriptor
 	}
 )
 
-func init() {
-	var err error
-	tempDir, err = os.MkdirTemp("", "DockerDown")
-	if err != nil {
-		os.Exit(0)
-	}
-
-	fmt.Printf("created temporary folder: %s\n", tempDir)
-}
-
 type Config struct {
-	Arch   string
-	Name   string
+	Arch string
+	Name string
+	// Images more images written to the same archive with Name, such as `docker save a b c`
+	Images []string
 	Proxy  string
 	Debug  bool
 	Output string
+	// Tags override name of image in archive, such as `registry.local/app:1`
+	Tags []string
+	// WaitRateLimit sleep until quota reset instead of failing when registry responds 429
+	WaitRateLimit bool
+	// LimitRate bandwidth limit of all blob transfers, such as `5M`
+	LimitRate string
+	// LimitSchedule rate in periods of day, such as `08:00-18:00=5M,18:00-08:00=off`
+	LimitSchedule string
+	// CacheDir directory of blob cache shared across runs, default is `~/.cache/downer`
+	CacheDir string
+	// NoCache download all blobs without blob cache
+	NoCache bool
+	// Format of output: docker, oci or oci-archive, default is docker
+	Format string
+	// Offline resolve image from blob cache only, never send request to registry
+	Offline bool
+	// CacheMaxSize evict least recently used blobs after pulling when cache is larger than it, such as `50G`
+	CacheMaxSize string
+	// Compression of archive: none, gzip or zstd, default is gzip for docker and none for OCI
+	Compression string
+	// CompressionLevel 0 means the default level of compression
+	CompressionLevel int
+	// SplitSize split archive into numbered parts of at most the size, such as `2G`
+	SplitSize string
+	// Credentials `user:password` of registry, credential saved by `docker login` is used if it's empty
+	Credentials string
+	// Insecure hosts of registries served with plain http, such as `localhost:5000`
+	Insecure []string
+	// Load stream archive to Docker daemon with `POST /images/load` instead of writing file
+	Load bool
+	// DockerHost address of Docker daemon to load, default is DOCKER_HOST or `unix:///var/run/docker.sock`
+	DockerHost string
+	// DryRun resolve images and print blobs to fetch and disk space needed without downloading layers
+	DryRun bool
 }
 
 // NewDp ...
@@ -98,24 +157,82 @@ func NewDp(cfg *Config) (*Dp, error) {
 
 	log.Debugf("get arch: %s", cfg.Arch)
 
-	name, tag := tools.ParseImage(cfg.Name)
-	// parse name exist slash
-	if strings.Contains(name, "/") {
-		librarys := strings.Split(name, "/")
-		library = strings.Join(librarys[:len(librarys)-1], "/")
-		name = librarys[len(librarys)-1]
+	format := cfg.Format
+	if format == "" {
+		format = archive.FormatDocker
+	}
+	if !archive.ValidFormat(format) {
+		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
-	log.Debugf("image: %s -> tag: %s", name, tag)
 
-	// TODO create specify directory
-	defualtClientOpts := []http.ClientOption{http.WithProxy(cfg.Proxy)}
-	client, err := http.NewClient(defualtClientOpts...)
+	compression := cfg.Compression
+	if compression == "" {
+		compression = compress.None
+		// archive loaded to daemon isn't compressed as it's never saved
+		if format == archive.FormatDocker && !cfg.Load {
+			compression = compress.Gzip
+		}
+	}
+	if err := compress.Valid(compression, cfg.CompressionLevel); err != nil {
+		return nil, err
+	}
+	if format == archive.FormatOCI && compression != compress.None {
+		return nil, errors.New("OCI layout is a directory and can't be compressed, use --format oci-archive")
+	}
+
+	var daemon *engine.Client
+	if cfg.Load {
+		if format == archive.FormatOCI || cfg.Output != "" || cfg.SplitSize != "" {
+			return nil, errors.New("--load streams archive to docker and can't be used with --output, --split-size or --format oci")
+		}
+		if daemon, err = engine.NewClient(cfg.DockerHost); err != nil {
+			return nil, err
+		}
+	}
+
+	var splitSize int64
+	if cfg.SplitSize != "" {
+		if splitSize, err = tools.ParseSize(cfg.SplitSize); err != nil {
+			return nil, err
+		}
+		if format == archive.FormatOCI || cfg.Output == Stdout {
+			return nil, errors.New("--split-size can only be used to write archive file")
+		}
+	}
+
+	images, err := parseImages(cfg, format)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		log.Debugf("image: %s -> tag: %s", image.ref.Name(), image.ref.Reference())
+	}
+
+	for _, tag := range cfg.Tags {
+		if _, err := tools.ParseReference(tag); err != nil {
+			return nil, fmt.Errorf("invalid tag: %w", err)
+		}
+	}
+	if len(cfg.Tags) > 0 && len(images) > 1 {
+		return nil, errors.New("--tag can only be used with single image")
+	}
+
+	client, err := newClient(cfg)
 	if err != nil {
 		log.Errorf("create client error: %s", err)
-		panic(err)
+		return nil, err
 	}
 
-	if cfg.Output != "" {
+	out := io.Writer(os.Stdout)
+	if cfg.Output == Stdout {
+		if format == archive.FormatOCI {
+			return nil, errors.New("OCI layout is a directory and can't be streamed, use --format oci-archive")
+		}
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return nil, errors.New("refusing to write archive to terminal, redirect or pipe stdout")
+		}
+		out = os.Stderr
+	} else if cfg.Output != "" && !cfg.DryRun {
 		// checkout output whether exist
 		if err := tools.CreatePathWithFilepath(cfg.Output); err != nil {
 			if errors.Is(err, tools.ErrFileExist) {
@@ -124,19 +241,89 @@ func NewDp(cfg *Config) (*Dp, error) {
 		}
 	}
 
+	if cfg.Offline && cfg.NoCache {
+		return nil, errors.New("offline mode requires blob cache, --no-cache can't be used with --offline")
+	}
+
+	var store *cache.Store
+	if !cfg.NoCache {
+		store, err = cache.Open(cfg.CacheDir)
+		if err != nil {
+			log.Errorf("open blob cache: %s", err)
+			return nil, err
+		}
+		log.Debugf("blob cache: %s", store.Root())
+	}
+
+	var cacheMaxSize int64
+	if cfg.CacheMaxSize != "" {
+		if cacheMaxSize, err = tools.ParseSize(cfg.CacheMaxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := parseCredential(cfg.Credentials); err != nil {
+		return nil, err
+	}
+
 	return &Dp{
 		client: client,
 		log:    log,
-		image: &Image{
-			name:   name,
-			tag:    tag,
+		cache:  store,
+		image:  images[0],
+		images: images,
+		out:    out,
+
+		compression:      compression,
+		compressionLevel: cfg.CompressionLevel,
+		splitSize:        splitSize,
+		waitRateLimit:    cfg.WaitRateLimit,
+		cacheMaxSize:     cacheMaxSize,
+		offline:          cfg.Offline,
+		credentials:      cfg.Credentials,
+		insecure:         insecureHosts(cfg.Insecure),
+		engine:           daemon,
+		dryRun:           cfg.DryRun,
+	}, nil
+}
+
+// parseImages parse Name and Images of config, duplicated images are ignored
+func parseImages(cfg *Config, format string) ([]*Image, error) {
+	var (
+		images []*Image
+		seen   = make(map[string]struct{})
+	)
+	for _, name := range append([]string{cfg.Name}, cfg.Images...) {
+		if name == "" {
+			continue
+		}
+		ref, err := tools.ParseReference(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[ref.String()]; ok {
+			continue
+		}
+		seen[ref.String()] = struct{}{}
+
+		images = append(images, &Image{
+			ref:    ref,
+			name:   ref.ShortName(),
+			tag:    ref.Tag,
+			tags:   cfg.Tags,
 			arch:   cfg.Arch,
 			output: cfg.Output,
-		},
-	}, nil
+			format: format,
+		})
+	}
+	if len(images) == 0 {
+		return nil, errors.New("no image specified")
+	}
+
+	return images, nil
 }
 
-// Run main process to download image with http request
+// Run main process to download images with http request and write them to one archive
 func (d *Dp) Run() error {
 	clean, err := d.init()
 	if err != nil {
@@ -145,29 +332,153 @@ func (d *Dp) Run() error {
 	}
 	defer clean()
 
-	meta, err := d.getRequstMeta(d.image.name, d.image.tag)
+	if d.dryRun {
+		return d.dryRunPlan()
+	}
+
+	images := make([]*archive.Image, 0, len(d.images))
+	for _, image := range d.images {
+		d.image = image
+		archiveImage, err := d.pull()
+		if err != nil {
+			return err
+		}
+		images = append(images, archiveImage)
+	}
+	d.image = d.images[0]
+
+	// fail before downloading layers if disk is too small for them
+	if err := d.plan().check(); err != nil {
+		return err
+	}
+
+	savedFilePath, err := d.write(images...)
 	if err != nil {
-		d.log.Errorf("get request meta: %s", err)
-		panic(err)
+		d.log.Errorf("write %s archive: %s", d.image.format, err)
+		return err
+	}
+
+	if !d.offline {
+		for _, image := range d.images {
+			d.image = image
+			if err := d.recordRef(); err != nil {
+				d.log.Warnf("record image in blob cache: %s", err)
+			}
+		}
+		if err := d.evictCache(); err != nil {
+			d.log.Warnf("evict blob cache: %s", err)
+		}
+	}
+	d.image = d.images[0]
+
+	if d.rateLimit != nil {
+		d.log.Infof("rate limit: %s", d.rateLimit)
+		fmt.Fprintf(d.out, "rate limit: %s\n", d.rateLimit)
+	}
+	if savedFilePath == Stdout {
+		fmt.Fprintf(d.out, "exported images to stdout\n")
+		return nil
+	}
+	if d.engine != nil {
+		fmt.Fprintf(d.out, "loaded images to docker\n")
+		return nil
+	}
+	if d.splitSize > 0 {
+		manifest := savedFilePath + compress.PartsSuffix
+		fmt.Fprintf(d.out, "exported images in parts: %s\n", manifest)
+		fmt.Fprintf(d.out, "you can use `downer join %s -o - | docker load` to load to Docker\n", manifest)
+		return nil
+	}
+	fmt.Fprintf(d.out, "exported images: %s\n", savedFilePath)
+	switch d.image.format {
+	case archive.FormatOCI:
+		fmt.Fprintf(d.out, "you can use `skopeo copy oci:%s:%s <destination>` to copy it\n", savedFilePath, d.image.tag)
+	case archive.FormatOCIArchive:
+		fmt.Fprintf(d.out, "you can use `podman load -i %s` or `ctr images import %s` to load it\n", savedFilePath, savedFilePath)
+	default:
+		fmt.Fprintf(d.out, "you can use `docker load -i %s` to load to Docker\n", savedFilePath)
 	}
-	d.log.Debugf("auth meta: %#v", meta)
 
-	token, err := d.getTokenInfo(meta)
+	return nil
+}
+
+// pull resolve current image and return it with layers which are downloaded when archive is written
+func (d *Dp) pull() (*archive.Image, error) {
+	digestSource, err := d.resolveBlobs()
 	if err != nil {
-		d.log.Errorf("get token info: ", err)
-		panic(err)
+		return nil, err
+	}
+	layers := digestSource.Layers
+
+	fmt.Fprintf(d.out, "%s: load layers length: %d, start download...\n", d.image.ref.Familiar(), len(layers))
+
+	image := d.image
+	config, err := d.getConfig(image, digestSource.Config.Digest, digestSource.Config.MediaType)
+	if err != nil {
+		d.log.Errorf("get blobs: ", err)
+		return nil, err
+	}
+
+	archiveImage := &archive.Image{
+		Config:            config,
+		ConfigMediaType:   digestSource.Config.MediaType,
+		Manifest:          digestSource.content,
+		ManifestMediaType: digestSource.MediaType,
+		Platform:          parsePlatform(d.image.arch),
+		RepoTags:          d.repoTags(),
+		Layers:            make([]archive.Layer, 0, len(layers)),
+	}
+	for index, layer := range layers {
+		archiveLayer := archive.Layer{
+			Descriptor: http.Descriptor{
+				MediaType: layer.MediaType,
+				Digest:    layer.Digest,
+				Size:      layer.Size,
+			},
+			Open: func() (io.ReadCloser, error) {
+				fmt.Fprintf(d.out, "downloading %s %d/%d: %s\n", image.name, index+1, len(layers), layer.Digest[7:])
+				return d.openBlob(image, layer.Digest, layer.MediaType)
+			},
+		}
+		if _, ok := d.exclude[layer.Digest]; ok {
+			fmt.Fprintf(d.out, "skipped %s %d/%d: %s\n", image.name, index+1, len(layers), layer.Digest[7:])
+			archiveLayer.Open = nil
+		}
+		archiveImage.Layers = append(archiveImage.Layers, archiveLayer)
+	}
+
+	return archiveImage, nil
+}
+
+// resolve find manifest of image for arch from registry, or from blob cache in offline mode
+func (d *Dp) resolve() (*imageManifest, error) {
+	if d.offline {
+		return d.resolveOffline()
+	}
+
+	if err := d.authorize(d.image); err != nil {
+		return nil, err
 	}
-	d.log.Debugf("token info: %#v", token)
 
-	b, err := d.refreshToken(token)
+	b, err := d.refreshToken()
 	if err != nil {
 		d.log.Errorf("fresh token: ", err)
-		panic(err)
+		return nil, err
+	}
+
+	if isManifest(b) {
+		// single platform image without index
+		digestSource, err := parseManifest(b)
+		if err != nil {
+			return nil, err
+		}
+		return &imageManifest{Manifest: digestSource, content: b, digest: d.image.indexDigest}, nil
 	}
 
-	if err = parseManifests(b); err != nil {
+	arch2Manifest, err := parseManifests(b)
+	if err != nil {
 		d.log.Errorf("parse manifests: ", err)
-		panic(err)
+		return nil, err
 	}
 
 	// TODO 解析Manifest
@@ -179,290 +490,309 @@ func (d *Dp) Run() error {
 	manifest, ok := arch2Manifest[d.image.arch]
 	if !ok {
 		d.log.Infof("don't found arch: %s", d.image.arch)
-		return err
+		return nil, fmt.Errorf("don't found arch: %s", d.image.arch)
 	}
 
-	digestSource, err := d.getDigestSource(manifest.Digest, token.Token)
+	digestSource, content, err := d.getDigestSource(manifest.Digest)
 	if err != nil {
 		d.log.Errorf("get digest source: ", err)
-		panic(err)
+		return nil, err
 	}
-	layers := digestSource.Layers
 
-	fmt.Printf("load layers length: %d, start download...\n", len(layers))
+	return &imageManifest{Manifest: digestSource, content: content, digest: manifest.Digest}, nil
+}
 
-	digestModel, err := d.saveDegistFile(digestSource.Config.Digest, digestSource.Config.MediaType, token.Token)
-	if err != nil {
-		d.log.Errorf("get blobs: ", err)
-		panic(err)
+// write images to output with format, docker-archive and oci-archive are streamed to
+// output file or stdout while layers are downloaded
+func (d *Dp) write(images ...*archive.Image) (string, error) {
+	output := d.outputPath()
+	if d.engine != nil {
+		return "", d.load(func(w io.Writer) error {
+			if d.image.format == archive.FormatOCIArchive {
+				return archive.StreamOCI(w, images...)
+			}
+			return archive.StreamDocker(w, images...)
+		})
+	}
+	switch d.image.format {
+	case archive.FormatOCI:
+		fmt.Fprintf(d.out, "write OCI layout...\n")
+		return output, archive.WriteOCI(output, images...)
+	case archive.FormatOCIArchive:
+		return output, d.stream(output, func(w io.Writer) error {
+			return archive.StreamOCI(w, images...)
+		})
+	default:
+		return output, d.stream(output, func(w io.Writer) error {
+			return archive.StreamDocker(w, images...)
+		})
 	}
+}
 
-	var parentID string
-	layersID := make([]string, 0, len(layers))
-	for index, layer := range layers {
-		data := make(map[string]any)
-
-		tempJson := digestModel
-
-		currentID := tools.GenLayerID(parentID, layer.Digest)
-		layersID = append(layersID, fmt.Sprintf("%s%s", currentID, LayerName))
-
-		if index == len(layers)-1 {
-			delete(tempJson, "history")
-			delete(tempJson, "rootfs")
-			data = tempJson
-		} else {
-			data["created"] = DefaultTime
+// stream write archive to output, partially written file is removed on failure
+func (d *Dp) stream(output string, write func(w io.Writer) error) error {
+	if d.splitSize > 0 {
+		sw, err := compress.NewSplitWriter(output, d.splitSize)
+		if err != nil {
+			return err
 		}
-		data["container_config"] = containerConfig
-		data["id"] = currentID
-		if parentID != "" {
-			data["parent"] = parentID
+		if err := d.writeArchive(sw, write); err != nil {
+			sw.Remove()
+			return err
 		}
-		parentID = currentID
-
-		fmt.Printf("downloading %d/%d: %s\n", index+1, len(layers), layer.Digest[7:])
-		if err = d.saveSingleLayer(currentID, layer.Digest, layer.MediaType, token.Token, data); err != nil {
-			d.log.Errorf("save single layer: ", err)
+		if err := sw.Close(); err != nil {
+			sw.Remove()
 			return err
 		}
+		fmt.Fprintf(d.out, "split archive into %d parts\n", len(sw.Manifest().Parts))
+		for _, part := range sw.Manifest().Parts {
+			d.files = append(d.files, filepath.Join(filepath.Dir(output), part.Name))
+		}
+		d.files = append(d.files, output+compress.PartsSuffix)
+		return nil
 	}
 
-	repoFile, err := os.Create(d.buildSavePath(Repositories))
-	if err != nil {
-		d.log.Error(err)
-		return err
+	f := os.Stdout
+	if output != Stdout {
+		var err error
+		if f, err = os.Create(output); err != nil {
+			return err
+		}
 	}
-	defer repoFile.Close()
 
-	_, err = repoFile.WriteString(fmt.Sprintf(repositoriesContent, d.image.name, d.image.tag, parentID))
-	if err != nil {
-		d.log.Error(err)
-		return err
+	err := d.writeArchive(f, write)
+	if output != Stdout {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+		} else {
+			d.files = append(d.files, output)
+		}
 	}
 
-	manifests := make([]http.RootManifest, 1)
-	manifests[0].Config = fmt.Sprintf("%s.json", digestSource.Config.Digest[7:])
-	manifests[0].RepoTags = []string{fmt.Sprintf("%s:%s", d.image.name, d.image.tag)}
-	manifests[0].Layers = layersID
+	return err
+}
 
-	manifestJson, err := os.Create(d.buildSavePath(ManifestJson))
-	if err != nil {
-		d.log.Error(err)
-		return err
-	}
-	defer manifestJson.Close()
+var errLoadStopped = errors.New("docker stopped reading archive")
 
-	c, err := json.Marshal(manifests)
-	if err != nil {
-		d.log.Error(err)
-		return err
+// load stream archive to docker daemon and print its progress
+func (d *Dp) load(write func(w io.Writer) error) error {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := d.writeArchive(w, write)
+		w.CloseWithError(err)
+		done <- err
+	}()
+
+	fmt.Fprintf(d.out, "load images to docker...\n")
+	err := d.engine.Load(context.Background(), r, d.out)
+	// unblock writer if daemon stops reading archive
+	r.CloseWithError(errLoadStopped)
+	if writeErr := <-done; writeErr != nil && (err == nil || !errors.Is(writeErr, errLoadStopped)) {
+		return writeErr
 	}
-	_, err = manifestJson.Write(c)
+
+	return err
+}
+
+func (d *Dp) writeArchive(w io.Writer, write func(w io.Writer) error) error {
+	return compressTo(w, d.compression, d.compressionLevel, write)
+}
+
+// compressTo call write with writer compressing to w
+func compressTo(w io.Writer, compression string, level int, write func(w io.Writer) error) error {
+	cw, err := compress.NewWriter(w, compression, level)
 	if err != nil {
-		d.log.Error(err)
 		return err
 	}
-
-	fmt.Printf("start merge all layers...\n")
-	savedFilePath, err := d.compress()
-	if err != nil {
+	if err := write(cw); err != nil {
+		cw.Close()
 		return err
 	}
 
-	fmt.Printf("exported images: %s\n", savedFilePath)
-	fmt.Printf("you can use `docker load -i %s` to load to Docker\n", savedFilePath)
-
-	return nil
+	return cw.Close()
 }
 
-// compress folder with tar and gzip
-func (d *Dp) compress() (string, error) {
-	var output string
+// outputPath return output specified by user, or default name by format
+func (d *Dp) outputPath() string {
 	if d.image.output != "" {
-		output = d.image.output
-	} else {
-		output = fmt.Sprintf(OutFileTmpl, d.image.name, d.image.tag, strings.ReplaceAll(d.image.arch, "/", "-"))
+		return d.image.output
 	}
 
-	if err := compress.Build(d.getDefaultPath(), output); err != nil {
-		d.log.Error(err)
-		return "", err
+	name := fmt.Sprintf(OutFileTmpl, d.image.name, d.fileTag(), strings.ReplaceAll(d.image.arch, "/", "-"))
+	if len(d.images) > 1 {
+		name = fmt.Sprintf(OutFileTmpl, "images", fmt.Sprint(len(d.images)), strings.ReplaceAll(d.image.arch, "/", "-"))
 	}
-
-	return output, nil
+	if d.image.format == archive.FormatOCI {
+		return name
+	}
+	return name + ".tar" + compress.Extension(d.compression)
 }
 
 func (d *Dp) init() (func() error, error) {
-	if err := tools.CreateDirWithPath((d.getDefaultPath())); err != nil {
+	tempDir, err := os.MkdirTemp("", "DockerDown")
+	if err != nil {
 		return nil, err
 	}
+	d.tempDir = tempDir
+	fmt.Fprintf(d.out, "created temporary folder: %s\n", tempDir)
 
 	return func() error {
-		defer fmt.Printf("removed temporary folder: %s\n", tempDir)
+		defer fmt.Fprintf(d.out, "removed temporary folder: %s\n", tempDir)
 		return os.RemoveAll(tempDir)
 	}, nil
 }
 
-func (d *Dp) saveSingleLayer(id string, digest string, mediaType string, token string, data map[string]any) error {
-	path := d.buildSavePath(id)
-	if err := tools.CreateDirWithPath(path); err != nil {
-		d.log.Errorf("create directory: ", err)
-		return err
-	}
-
-	f, err := os.Create(filepath.Join(path, VERSION))
+// getConfig download config blob of image
+func (d *Dp) getConfig(image *Image, digest, mediaType string) ([]byte, error) {
+	f, err := d.openBlob(image, digest, mediaType)
 	if err != nil {
-		d.log.Errorf(err.Error())
-		return err
+		return nil, err
 	}
 	defer f.Close()
-	f.WriteString("1.0")
 
-	blogResponse, err := d.getBlob(digest, mediaType, token)
-	if err != nil {
-		d.log.Errorf(err.Error())
-		return err
-	}
-
-	layerFile, err := os.Create(fmt.Sprintf("%s/%s", path, "layer.tar"))
-	if err != nil {
-		d.log.Errorf(err.Error())
-	}
-	defer layerFile.Close()
-
-	layerFile.Write(blogResponse.Body())
+	return io.ReadAll(f)
+}
 
-	dataMarshaled, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
+// openBlob open blob which is taken from cache if it has been downloaded by any run before,
+// without cache blob is downloaded to temporary folder and removed after closing
+func (d *Dp) openBlob(image *Image, digest, mediaType string) (io.ReadCloser, error) {
+	if d.cache == nil {
+		path := filepath.Join(d.tempDir, BLOBS, digest[7:])
+		if err := tools.CreateDirWithPath(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.downloadBlob(image, digest, mediaType, f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
 
-	jsonFile, err := os.Create(fmt.Sprintf("%s/json", path))
-	if err != nil {
-		d.log.Errorf(err.Error())
+		return &tempFile{File: f}, nil
 	}
-	defer jsonFile.Close()
 
-	jsonFile.Write(dataMarshaled)
-
-	return nil
-}
-
-// saveDegistFile
-func (d *Dp) saveDegistFile(digest, mediaType, token string) (map[string]any, error) {
-	r, err := d.getBlob(digest, mediaType, token)
+	cached, err := d.cache.Write(digest, func(w io.Writer) error {
+		return d.downloadBlob(image, digest, mediaType, w)
+	})
 	if err != nil {
-		d.log.Errorf("get registery request: ", err)
 		return nil, err
 	}
-
-	var digestModel map[string]any
-	if err := json.Unmarshal(r.Body(), &digestModel); err != nil {
-		d.log.Errorf("unmarshal digest model: ", err)
-		return nil, err
+	if cached {
+		d.log.Debugf("blob cache hit: %s", digest)
+		fmt.Fprintf(d.out, "found in cache: %s\n", digest[7:])
 	}
 
-	return digestModel, d.saveWithPath(r.Body(), fmt.Sprintf("%s.json", digest[7:]))
+	return d.cache.Open(digest)
 }
 
-func (d *Dp) getBlob(digest, mediaType, token string) (*http.Response, error) {
-	response, err := d.buildRegistryRequest(BLOBS, d.image.name, digest, http.SetAccept(mediaType), http.SetAuthToken(token))
-	if err != nil {
-		d.log.Errorf("get registery request: ", err)
-		return nil, err
-	}
+// tempFile remove itself after closing
+type tempFile struct {
+	*os.File
+}
 
-	return response, nil
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
 }
 
-func (d *Dp) saveWithPath(content []byte, path string) error {
-	targetPath := filepath.Join(d.getDefaultPath(), path)
-	f, err := os.Create(targetPath)
-	if err != nil {
+// downloadBlob stream blob to w, the speed is limited by bandwidth limiter of client. Layers are
+// downloaded long after image is resolved, so token is requested again if it expires or is rejected.
+func (d *Dp) downloadBlob(image *Image, digest, mediaType string, w io.Writer) error {
+	if d.offline {
+		return fmt.Errorf("%w: %s", tools.ErrOffline, digest)
+	}
+	if err := d.renewToken(image); err != nil {
 		return err
 	}
-	defer f.Close()
 
-	f.Write(content)
-	return nil
+	url := fmt.Sprintf(registryUrl, d.endpoint(image.ref), image.ref.Repository, BLOBS, digest)
+	d.log.Debugf("download blob with url: %s", url)
+	r, err := d.client.Download(context.Background(), url, w, http.SetAccept(mediaType), image.authorization())
+	if r != nil && r.Code() == nethttp.StatusUnauthorized {
+		// nothing is written to w with 401, so blob is downloaded again with new token
+		d.log.Debugf("token of %s is rejected, request a new one", image.ref)
+		if err := d.authorize(image); err != nil {
+			return err
+		}
+		_, err = d.client.Download(context.Background(), url, w, http.SetAccept(mediaType), image.authorization())
+	}
+
+	return err
 }
 
-func (d *Dp) getDigestSource(digest, token string) (*http.AutoGenerated, error) {
-	r, err := d.manifestsRequest(digest, http.SetAccept("application/vnd.docker.distribution.manifest.v2+json"), http.SetAuthToken(token))
+func (d *Dp) getDigestSource(digest string) (*http.Manifest, []byte, error) {
+	r, err := d.manifestsRequest(digest, http.SetAccept(AcceptManifest), d.image.authorization())
 	if err != nil {
 		d.log.Errorf("manifestsRequest: ", err)
-		return nil, err
+		return nil, nil, err
+	}
+	if err := checkResponse(r); err != nil {
+		return nil, nil, err
 	}
 
-	var data http.AutoGenerated
-	if err := json.Unmarshal(r.Body(), &data); err != nil {
+	data, err := parseManifest(r.Body())
+	if err != nil {
 		d.log.Errorf("manifestsRequest: ", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	d.log.Debugf("%s", r.Body())
-	return &data, nil
+	d.cacheManifest(r.Body())
+	return data, r.Body(), nil
 }
 
-func (d *Dp) refreshToken(token *http.TokenInfo) ([]byte, error) {
+func (d *Dp) refreshToken() ([]byte, error) {
 	r, err := d.buildRegistryRequest(MANIFESTS,
-		d.image.name,
-		d.image.tag,
+		d.image.ref.Repository,
+		d.image.ref.Reference(),
 		http.SetAccept(AcceptRefresh),
-		http.SetAuthToken(token.Token),
+		d.image.authorization(),
 	)
 	if err != nil {
 		d.log.Errorf("get registery request: ", err)
 		return nil, err
 	}
-
-	return r.Body(), nil
-}
-
-func (d *Dp) getTokenInfo(meta *http.AuthMD) (*http.TokenInfo, error) {
-	authUrl := meta.BuildAuthUrl()
-
-	r, err := d.client.Do(context.Background(), authUrl)
-	if err != nil {
-		d.log.Error(err)
-		return nil, err
-	}
-
-	var token http.TokenInfo
-	if err := json.Unmarshal(r.Body(), &token); err != nil {
-		d.log.Error(err)
+	if err := checkResponse(r); err != nil {
 		return nil, err
 	}
+	d.image.indexDigest = manifestDigest(r)
+	d.cacheManifest(r.Body())
+	d.image.indexMediaType = r.Header.Get("Content-Type")
 
-	return &token, nil
+	return r.Body(), nil
 }
 
-func (d *Dp) getRequstMeta(image, tag string) (*http.AuthMD, error) {
+// getChallenge return challenge of registry to request of manifest, nil if registry doesn't require authentication
+func (d *Dp) getChallenge(image, tag string) (*http.Challenge, error) {
 	r, err := d.buildRegistryRequest(MANIFESTS, image, tag)
 	if err != nil {
 		d.log.Errorf("get registery request: %s", err)
 		return nil, err
 	}
-
-	var md http.AuthMD
-	authenticate := r.Header.Get(WwwAuthenticate)
-	authenticateSplited := strings.Split(authenticate, "\"")
-	if len(authenticateSplited) > 2 {
-		md.AuthUrl = authenticateSplited[1]
-	}
-	if len(authenticateSplited) > 4 {
-		md.Service = authenticateSplited[3]
-	}
-	if len(authenticateSplited) > 6 {
-		md.Scope = authenticateSplited[5]
+	if r.Code() != nethttp.StatusUnauthorized {
+		return nil, nil
 	}
 
-	return &md, err
+	challenge := http.ParseChallenge(r.Header.Get(WwwAuthenticate))
+	if challenge == nil {
+		return nil, fmt.Errorf("registry %s requires authentication without challenge", d.image.ref.Registry)
+	}
+	return challenge, nil
 }
 
 func (d *Dp) manifestsRequest(digest string, opts ...http.HeaderOption) (*http.Response, error) {
-	r, err := d.buildRegistryRequest(MANIFESTS, d.image.name, digest, opts...)
+	r, err := d.buildRegistryRequest(MANIFESTS, d.image.ref.Repository, digest, opts...)
 	if err != nil {
 		d.log.Errorf("get registery request: ", err)
 		return nil, err
@@ -471,47 +801,98 @@ func (d *Dp) manifestsRequest(digest string, opts ...http.HeaderOption) (*http.R
 }
 
 func (d *Dp) buildRegistryRequest(kind string, image, tag string, opts ...http.HeaderOption) (*http.Response, error) {
-	url := fmt.Sprintf(registryUrl, library, image, kind, tag)
-	d.log.Debugf("send request with url: %s", url)
-	r, err := d.client.Do(context.Background(), url, opts...)
+	url := fmt.Sprintf(registryUrl, d.registryEndpoint(), image, kind, tag)
+	for retries := 0; ; retries++ {
+		d.log.Debugf("send request with url: %s", url)
+		r, err := d.client.Do(context.Background(), url, opts...)
+		if err != nil {
+			return nil, err
+		}
+		d.log.Debugf("response status code: %d", r.Code())
+
+		if kind == MANIFESTS {
+			d.recordRateLimit(r)
+		}
+		if r.Code() != nethttp.StatusTooManyRequests {
+			return r, nil
+		}
+
+		wait, err := d.rateLimitWait(r, retries)
+		if err != nil {
+			d.log.Error(err)
+			return nil, err
+		}
+		fmt.Fprintf(d.out, "rate limited by registry, waiting %s for quota to reset...\n", wait)
+		sleep(wait)
+	}
+}
+
+// parsePlatform parse platform like `linux/arm64/v8`
+func parsePlatform(arch string) *http.Platform {
+	parts := strings.SplitN(arch, "/", 3)
+	if len(parts) < 2 {
+		return nil
+	}
+
+	platform := &http.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform
+}
+
+// newClient create client with proxy and bandwidth limit of config
+func newClient(cfg *Config) (*http.Client, error) {
+	limiter, err := newLimiter(cfg.LimitRate, cfg.LimitSchedule)
 	if err != nil {
 		return nil, err
 	}
-	d.log.Debugf("response status code: %d", r.Code())
 
-	return r, nil
+	// TODO create specify directory
+	defualtClientOpts := []http.ClientOption{http.WithProxy(cfg.Proxy), http.WithLimiter(limiter)}
+	return http.NewClient(defualtClientOpts...)
 }
 
-func (d *Dp) buildSavePath(path string) string {
-	return filepath.Join(tempDir, fmt.Sprintf("%s-%s-%s", d.image.name, d.image.tag, strings.ReplaceAll(d.image.arch, "/", "-")), path)
-}
+// newLimiter return nil if neither rate nor schedule is set
+func newLimiter(rate, schedule string) (*http.Limiter, error) {
+	if rate == "" && schedule == "" {
+		return nil, nil
+	}
 
-func (d *Dp) getDefaultPath() string {
-	return d.buildSavePath("")
-}
+	limitRate, err := http.ParseRate(rate)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := http.ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
 
-func parseManifests(manifests []byte) error {
-	var tem map[string]any
+	return http.NewLimiter(limitRate, rules...), nil
+}
 
-	if err := json.Unmarshal(manifests, &tem); err != nil {
-		return err
+// parseManifests return descriptors of manifests in index keyed by platform like `linux/arm64/v8`,
+// manifest is also keyed by platform without variant unless another one has been
+func parseManifests(manifests []byte) (map[string]http.Descriptor, error) {
+	var index http.Index
+	if err := json.Unmarshal(manifests, &index); err != nil {
+		return nil, err
 	}
-	if data, ok := tem["manifests"]; ok {
-		for _, item := range data.([]any) {
-			manifestItem := item.(map[string]any)
-			platform := manifestItem["platform"].(map[string]any)
-			os := platform["os"]
-			architecture := platform["architecture"]
-			if os == UNKNOWN || architecture == UNKNOWN {
-				continue
-			}
 
-			arch2Manifest[fmt.Sprintf("%s/%s", os, architecture)] = &http.Manifest{
-				Arch:      architecture.(string),
-				Digest:    manifestItem["digest"].(string),
-				MediaType: manifestItem["mediaType"].(string),
-			}
+	arch2Manifest := map[string]http.Descriptor{}
+	for _, manifest := range index.Manifests {
+		platform := manifest.Platform
+		if platform == nil || platform.OS == UNKNOWN || platform.Architecture == UNKNOWN {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", platform.OS, platform.Architecture)
+		if platform.Variant != "" {
+			arch2Manifest[platform.String()] = manifest
+		}
+		if _, ok := arch2Manifest[key]; !ok {
+			arch2Manifest[key] = manifest
 		}
 	}
-	return nil
+	return arch2Manifest, nil
 }
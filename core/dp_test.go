@@ -0,0 +1,267 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+func TestRunMultipleImages(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestImage(t, store, "nginx", "alpine")
+	putTestImage(t, store, "redis", "7")
+
+	output := filepath.Join(t.TempDir(), "images.tar.zst")
+	d, err := NewDp(&Config{
+		Arch:        "linux/amd64",
+		Images:      []string{"nginx:alpine", "redis:7", "docker.io/library/nginx:alpine"},
+		Output:      output,
+		CacheDir:    cacheDir,
+		Offline:     true,
+		Compression: "zstd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := archive.OpenReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	manifests, err := r.DockerManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repoTags []string
+	for _, manifest := range manifests {
+		repoTags = append(repoTags, manifest.RepoTags...)
+	}
+	if want := []string{"nginx:alpine", "redis:7"}; !slices.Equal(repoTags, want) {
+		t.Fatalf("got %v, want %v", repoTags, want)
+	}
+
+	if _, err := NewDp(&Config{Images: []string{"nginx", "redis"}, Tags: []string{"app:1"}, NoCache: true}); err == nil {
+		t.Fatal("expected error of --tag with several images")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	cases := []struct {
+		format      string
+		compression string
+		want        string
+	}{
+		{"", "", "nginx-alpine-linux-amd64.tar.gz"},
+		{"docker", "zstd", "nginx-alpine-linux-amd64.tar.zst"},
+		{"oci-archive", "", "nginx-alpine-linux-amd64.tar"},
+		{"oci-archive", "gzip", "nginx-alpine-linux-amd64.tar.gz"},
+		{"oci", "", "nginx-alpine-linux-amd64"},
+	}
+	for _, c := range cases {
+		d, err := NewDp(&Config{Arch: "linux/amd64", Name: "nginx:alpine", Format: c.format, Compression: c.compression, NoCache: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.outputPath(); got != c.want {
+			t.Fatalf("got %s, want %s", got, c.want)
+		}
+	}
+
+	if _, err := NewDp(&Config{Name: "nginx", Format: "oci", Compression: "gzip", NoCache: true}); err == nil {
+		t.Fatal("expected error of compressed OCI layout")
+	}
+}
+
+func TestRunLoad(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestImage(t, store, "nginx", "alpine")
+
+	// fake Engine API on unix socket which reads tags of archive loaded
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded []string
+	server := &httptest.Server{Listener: listener, Config: &nethttp.Server{Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				fmt.Fprintf(w, `{"errorDetail":{"message":%q}}`, err.Error())
+				return
+			}
+			if header.Name != archive.ManifestJson {
+				continue
+			}
+			var manifests []http.RootManifest
+			json.NewDecoder(tr).Decode(&manifests)
+			for _, manifest := range manifests {
+				loaded = append(loaded, manifest.RepoTags...)
+				fmt.Fprintf(w, `{"stream":"Loaded image: %s\n"}`, manifest.RepoTags[0])
+			}
+			io.Copy(io.Discard, r.Body)
+			return
+		}
+	})}}
+	server.Start()
+	defer server.Close()
+
+	d, err := NewDp(&Config{
+		Arch:       "linux/amd64",
+		Name:       "nginx:alpine",
+		CacheDir:   cacheDir,
+		Offline:    true,
+		Load:       true,
+		DockerHost: "unix://" + socket,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress bytes.Buffer
+	d.out = &progress
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 1 || loaded[0] != "nginx:alpine" {
+		t.Fatalf("unexpected images loaded: %v", loaded)
+	}
+	if !strings.Contains(progress.String(), "Loaded image: nginx:alpine") {
+		t.Fatalf("progress of docker isn't reported: %s", progress.String())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	registry := newTestRegistry(t)
+	image := seedRegistry(t, registry, "library/nginx", "alpine")
+	cacheDir := t.TempDir()
+	output := filepath.Join(t.TempDir(), "images", "nginx.tar")
+
+	d, err := NewDp(&Config{
+		Arch:        "linux/amd64",
+		Name:        registry.host() + "/library/nginx:alpine",
+		CacheDir:    cacheDir,
+		Output:      output,
+		Compression: compress.None,
+		Insecure:    []string{registry.host()},
+		DryRun:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	d.out = &buf
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	printed := buf.String()
+	for _, digest := range append([]string{image.config}, image.layers...) {
+		if !strings.Contains(printed, digest) {
+			t.Fatalf("blob %s isn't listed:\n%s", digest, printed)
+		}
+		if d.cache.Has(digest) {
+			t.Fatalf("blob %s is downloaded in dry run", digest)
+		}
+	}
+	if !strings.Contains(printed, "estimated output: "+output) {
+		t.Fatalf("output isn't estimated:\n%s", printed)
+	}
+	if _, err := os.Stat(filepath.Dir(output)); !os.IsNotExist(err) {
+		t.Fatalf("output directory is created in dry run: %v", err)
+	}
+
+	plan := d.plan()
+	if plan.download == 0 || plan.cached != 0 || plan.output != plan.uncompressed || len(plan.disks) == 0 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	plan.disks[0].need = plan.disks[0].free + 1
+	if err := plan.check(); !errors.Is(err, tools.ErrNoSpace) {
+		t.Fatalf("expected no space error, got %v", err)
+	}
+}
+
+func TestTokenRenew(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.auth = true
+	image := seedRegistry(t, registry, "library/nginx", "alpine")
+
+	d, err := NewDp(&Config{
+		Name:     registry.host() + "/library/nginx:alpine",
+		Arch:     "linux/amd64",
+		NoCache:  true,
+		Insecure: []string{registry.host()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.out = io.Discard
+	clean, err := d.init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+	d.image = d.images[0]
+	pulled, err := d.pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// layers are downloaded after token of resolving is rejected
+	registry.expireTokens()
+	tokens := registry.tokens
+	r, err := pulled.Layers[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if registry.rejected != 1 || registry.tokens != tokens+1 {
+		t.Fatalf("expected token requested again after 401, rejected %d, tokens %d", registry.rejected, registry.tokens)
+	}
+
+	// token expiring soon is renewed before request
+	d.images[0].tokenExpiry = time.Now().Add(time.Second)
+	r, err = pulled.Layers[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if registry.rejected != 1 || registry.tokens != tokens+2 {
+		t.Fatalf("expected token renewed before expiry, rejected %d, tokens %d", registry.rejected, registry.tokens)
+	}
+	if len(pulled.Layers) != len(image.layers) {
+		t.Fatalf("unexpected layers: %d", len(pulled.Layers))
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+type (
+	// Inspected metadata of image, which is read from index, manifests and configs without layers
+	Inspected struct {
+		// Reference full reference, such as `docker.io/library/nginx:alpine`
+		Reference string              `json:"reference"`
+		Digest    string              `json:"digest"`
+		MediaType string              `json:"mediaType,omitempty"`
+		Platforms []InspectedPlatform `json:"platforms"`
+	}
+
+	// InspectedPlatform manifest and config of image for platform
+	InspectedPlatform struct {
+		Platform  string            `json:"platform"`
+		Digest    string            `json:"digest"`
+		MediaType string            `json:"mediaType,omitempty"`
+		Config    http.Descriptor   `json:"config"`
+		Layers    []http.Descriptor `json:"layers"`
+		// Size total compressed size of layers
+		Size         int64             `json:"size"`
+		Created      *time.Time        `json:"created,omitempty"`
+		User         string            `json:"user,omitempty"`
+		WorkingDir   string            `json:"workingDir,omitempty"`
+		Entrypoint   []string          `json:"entrypoint,omitempty"`
+		Cmd          []string          `json:"cmd,omitempty"`
+		Env          []string          `json:"env,omitempty"`
+		ExposedPorts []string          `json:"exposedPorts,omitempty"`
+		Labels       map[string]string `json:"labels,omitempty"`
+		History      []http.History    `json:"history,omitempty"`
+	}
+)
+
+// Inspect read metadata of image of cfg.Name for platform cfg.Arch, all platforms are inspected if
+// it's empty, only index, manifests and config blobs are downloaded
+func Inspect(cfg *Config) (*Inspected, error) {
+	ref, err := tools.ParseReference(cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	config := *cfg
+	config.NoCache = true
+	d, err := newRemote(&config)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.use(ref); err != nil {
+		return nil, err
+	}
+
+	r, err := d.manifestsRequest(ref.Reference(), http.SetAccept(AcceptRefresh), d.image.authorization())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(r); err != nil {
+		return nil, err
+	}
+	content := r.Body()
+	inspected := &Inspected{
+		Reference: ref.String(),
+		Digest:    manifestDigest(r),
+		MediaType: contentMediaType(r.Header.Get("Content-Type"), content),
+	}
+
+	if isManifest(content) {
+		platform, err := d.inspectManifest(inspected.Digest, inspected.MediaType, content)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Arch != "" && !matchPlatform(cfg.Arch, platform.Platform) {
+			return nil, fmt.Errorf("don't found arch: %s", cfg.Arch)
+		}
+		inspected.Platforms = []InspectedPlatform{*platform}
+		return inspected, nil
+	}
+
+	var index http.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+	for _, desc := range index.Manifests {
+		if desc.Platform == nil || desc.Platform.OS == UNKNOWN {
+			continue
+		}
+		if cfg.Arch != "" && !matchPlatform(cfg.Arch, desc.Platform.String()) {
+			continue
+		}
+		_, content, err := d.getDigestSource(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		platform, err := d.inspectManifest(desc.Digest, desc.MediaType, content)
+		if err != nil {
+			return nil, err
+		}
+		platform.Platform = desc.Platform.String()
+		inspected.Platforms = append(inspected.Platforms, *platform)
+	}
+	if cfg.Arch != "" && len(inspected.Platforms) == 0 {
+		return nil, fmt.Errorf("don't found arch: %s", cfg.Arch)
+	}
+
+	return inspected, nil
+}
+
+// inspectManifest read layers of manifest and download its config, platform is read from config
+func (d *Dp) inspectManifest(digest, mediaType string, content []byte) (*InspectedPlatform, error) {
+	manifest, err := manifestBlobs(content)
+	if err != nil {
+		return nil, err
+	}
+	// manifestBlobs lists config before layers
+	platform := &InspectedPlatform{
+		Digest:    digest,
+		MediaType: mediaType,
+		Config:    manifest[0],
+		Layers:    manifest[1:],
+	}
+	for _, layer := range platform.Layers {
+		platform.Size += layer.Size
+	}
+
+	var buf bytes.Buffer
+	if err := d.downloadBlob(d.image, platform.Config.Digest, platform.Config.MediaType, &buf); err != nil {
+		return nil, fmt.Errorf("download config: %w", err)
+	}
+	var config http.ImageConfig
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	platform.Platform = config.Platform().String()
+	platform.Created = config.Created
+	platform.User = config.Config.User
+	platform.WorkingDir = config.Config.WorkingDir
+	platform.Entrypoint = config.Config.Entrypoint
+	platform.Cmd = config.Config.Cmd
+	platform.Env = config.Config.Env
+	platform.ExposedPorts = config.Config.ExposedPortList()
+	platform.Labels = config.Config.Labels
+	platform.History = config.History
+
+	return platform, nil
+}
+
+// matchPlatform report whether arch like `linux/arm64` matches platform with or without variant
+func matchPlatform(arch, platform string) bool {
+	if arch == platform {
+		return true
+	}
+	os, rest, _ := strings.Cut(platform, "/")
+	architecture, _, _ := strings.Cut(rest, "/")
+	return arch == os+"/"+architecture
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.auth = true
+	image := seedRegistry(t, registry, "library/nginx", "alpine")
+	registry.tag("library/nginx", "amd64", image.manifest, "application/vnd.oci.image.manifest.v1+json")
+
+	inspect := func(name, arch string) *Inspected {
+		t.Helper()
+		inspected, err := Inspect(&Config{Name: registry.host() + name, Arch: arch, Insecure: []string{registry.host()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inspected
+	}
+
+	inspected := inspect("/library/nginx:alpine", "")
+	if inspected.Digest != image.index || len(inspected.Platforms) != 1 {
+		t.Fatalf("unexpected inspected: %+v", inspected)
+	}
+	platform := inspected.Platforms[0]
+	if platform.Platform != "linux/amd64" || platform.Digest != image.manifest || platform.Config.Digest != image.config {
+		t.Fatalf("unexpected platform: %+v", platform)
+	}
+	var size int64
+	for index, layer := range platform.Layers {
+		if layer.Digest != image.layers[index] {
+			t.Fatalf("unexpected layer %d: %s", index, layer.Digest)
+		}
+		size += layer.Size
+	}
+	if size == 0 || platform.Size != size {
+		t.Fatalf("unexpected size: %d, want %d", platform.Size, size)
+	}
+	if !slices.Equal(platform.Cmd, []string{"sh"}) || len(platform.History) != 2 || platform.History[1].CreatedBy != "layer 1" {
+		t.Fatalf("unexpected config: %+v", platform)
+	}
+
+	// platform of single manifest is read from its config
+	inspected = inspect("/library/nginx:amd64", "linux/amd64")
+	if inspected.Digest != image.manifest || len(inspected.Platforms) != 1 || inspected.Platforms[0].Platform != "linux/amd64" {
+		t.Fatalf("unexpected inspected: %+v", inspected)
+	}
+
+	if _, err := Inspect(&Config{Name: registry.host() + "/library/nginx:alpine", Arch: "linux/arm64", Insecure: []string{registry.host()}}); err == nil {
+		t.Fatal("expected error for missing platform")
+	}
+}
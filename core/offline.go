@@ -0,0 +1,77 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+// resolveOffline resolve tag with ref recorded in blob cache, and check every blob
+// needed by archive is cached before building
+func (d *Dp) resolveOffline() (*imageManifest, error) {
+	ref := &cache.Ref{Digest: d.image.ref.Digest}
+	if ref.Digest == "" {
+		var err error
+		ref, err = d.cache.LoadRef(d.fullName(), d.image.tag)
+		if err != nil {
+			d.log.Debugf("load ref: %s", err)
+			return nil, fmt.Errorf("%w: %s", tools.ErrNotCached, d.image.ref)
+		}
+		d.log.Debugf("cached ref: %+v", ref)
+	}
+
+	manifestDigest, ok := ref.Platforms[d.image.arch]
+	if !ok {
+		index, err := d.cache.Get(ref.Digest)
+		if err != nil {
+			return nil, missingBlobs(ref.Digest)
+		}
+		if isManifest(index) {
+			manifestDigest = ref.Digest
+		} else {
+			arch2Manifest, err := parseManifests(index)
+			if err != nil {
+				return nil, err
+			}
+			manifest, ok := arch2Manifest[d.image.arch]
+			if !ok {
+				return nil, fmt.Errorf("don't found arch: %s", d.image.arch)
+			}
+			manifestDigest = manifest.Digest
+		}
+	}
+
+	content, err := d.cache.Get(manifestDigest)
+	if err != nil {
+		return nil, missingBlobs(manifestDigest)
+	}
+
+	var digestSource http.Manifest
+	if err := json.Unmarshal(content, &digestSource); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	if !d.cache.Has(digestSource.Config.Digest) {
+		missing = append(missing, digestSource.Config.Digest)
+	}
+	for _, layer := range digestSource.Layers {
+		if !d.cache.Has(layer.Digest) {
+			missing = append(missing, layer.Digest)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missingBlobs(missing...)
+	}
+
+	fmt.Fprintf(d.out, "resolved %s from cache: %s\n", d.image.ref, manifestDigest)
+	return &imageManifest{Manifest: &digestSource, content: content, digest: manifestDigest}, nil
+}
+
+func missingBlobs(digests ...string) error {
+	return fmt.Errorf("%w:\n  %s", tools.ErrBlobsMissing, strings.Join(digests, "\n  "))
+}
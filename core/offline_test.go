@@ -0,0 +1,191 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/tools"
+)
+
+type testImage struct {
+	index    string
+	manifest string
+	config   string
+	layers   []string
+	// diffIDs digest of uncompressed layers
+	diffIDs []string
+}
+
+// gzipLayer build gzip compressed layer tar with files
+func gzipLayer(t *testing.T, files map[string]string) ([]byte, string) {
+	t.Helper()
+
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(raw.Bytes())
+	gw.Close()
+
+	return compressed.Bytes(), fmt.Sprintf("sha256:%x", sha256.Sum256(raw.Bytes()))
+}
+
+// putTestImage put multi-platform image `docker.io/library/<name>:<tag>` with linux/amd64 into store
+func putTestImage(t *testing.T, store *cache.Store, name, tag string) *testImage {
+	t.Helper()
+
+	image := buildTestImage(t, name, func(content []byte) string {
+		return put(t, store, content)
+	})
+
+	err := store.SaveRef(&cache.Ref{
+		Name:      "docker.io/library/" + name,
+		Tag:       tag,
+		Digest:    image.index,
+		MediaType: "application/vnd.oci.image.index.v1+json",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return image
+}
+
+// buildTestImage build multi-platform image with linux/amd64, its blobs, manifest and index are saved by put
+func buildTestImage(t *testing.T, name string, put func(content []byte) string) *testImage {
+	t.Helper()
+
+	var image testImage
+	var layerDescs []map[string]any
+	for index := range 2 {
+		content, diffID := gzipLayer(t, map[string]string{fmt.Sprintf("file-%d", index): fmt.Sprintf("%s-%d", name, index)})
+		digest := put(content)
+		image.layers = append(image.layers, digest)
+		image.diffIDs = append(image.diffIDs, diffID)
+		layerDescs = append(layerDescs, map[string]any{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"digest":    digest,
+			"size":      len(content),
+		})
+	}
+
+	config, _ := json.Marshal(map[string]any{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      "2024-01-01T00:00:00Z",
+		"config":       map[string]any{"Cmd": []string{"sh"}},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": image.diffIDs},
+		"history":      []map[string]any{{"created_by": "layer 0"}, {"created_by": "layer 1"}},
+	})
+	image.config = put(config)
+
+	manifest, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        map[string]any{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": image.config, "size": len(config)},
+		"layers":        layerDescs,
+	})
+	image.manifest = put(manifest)
+
+	index, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests": []map[string]any{{
+			"mediaType": "application/vnd.oci.image.manifest.v1+json",
+			"digest":    image.manifest,
+			"size":      len(manifest),
+			"platform":  map[string]any{"os": "linux", "architecture": "amd64"},
+		}},
+	})
+	image.index = put(index)
+
+	return &image
+}
+
+func put(t *testing.T, store *cache.Store, content []byte) string {
+	t.Helper()
+
+	digest, err := store.Put(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest
+}
+
+func TestRunOffline(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestImage(t, store, "nginx", "alpine")
+
+	output := filepath.Join(t.TempDir(), "nginx.tar.gz")
+	d, err := NewDp(&Config{
+		Arch:     "linux/amd64",
+		Name:     "nginx:alpine",
+		Output:   output,
+		CacheDir: cacheDir,
+		Offline:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(output); err != nil || fi.Size() == 0 {
+		t.Fatalf("archive isn't created: %v", err)
+	}
+}
+
+func TestRunOfflineMissingBlobs(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := cache.Open(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := putTestImage(t, store, "nginx", "alpine")
+	path, _ := store.Path(image.layers[1])
+	os.Remove(path)
+
+	d, err := NewDp(&Config{
+		Arch:     "linux/amd64",
+		Name:     "nginx:alpine",
+		Output:   filepath.Join(t.TempDir(), "nginx.tar.gz"),
+		CacheDir: cacheDir,
+		Offline:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Run()
+	if !errors.Is(err, tools.ErrBlobsMissing) || !strings.Contains(err.Error(), image.layers[1]) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.image.tag = "latest"
+	if err := d.Run(); !errors.Is(err, tools.ErrNotCached) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
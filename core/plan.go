@@ -0,0 +1,215 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+// uncompressedRatio rough ratio of uncompressed to compressed size of layers, registries don't
+// report uncompressed size
+const uncompressedRatio = 2.5
+
+type (
+	// pullPlan blobs which pull fetches and disk space it needs
+	pullPlan struct {
+		blobs []planBlob
+		// download compressed size of blobs which aren't cached
+		download int64
+		// cached size of blobs found in blob cache
+		cached int64
+		// uncompressed estimated size of layers after decompression
+		uncompressed int64
+		// output estimated size of archive or layout, it's 0 if nothing is written to disk
+		output int64
+		disks  []planDisk
+	}
+
+	planBlob struct {
+		http.Descriptor
+		image  *Image
+		cached bool
+	}
+
+	// planDisk space needed in filesystem of path
+	planDisk struct {
+		path   string
+		device uint64
+		free   int64
+		need   int64
+	}
+)
+
+// resolveBlobs resolve manifest of current image for arch and record its config and layers
+func (d *Dp) resolveBlobs() (*imageManifest, error) {
+	digestSource, err := d.resolve()
+	if err != nil {
+		return nil, err
+	}
+	d.image.digest = digestSource.digest
+	d.image.mediaType = digestSource.MediaType
+
+	d.image.blobs = []http.Descriptor{{
+		MediaType: digestSource.Config.MediaType,
+		Digest:    digestSource.Config.Digest,
+		Size:      digestSource.Config.Size,
+	}}
+	for _, layer := range digestSource.Layers {
+		d.image.blobs = append(d.image.blobs, http.Descriptor{
+			MediaType: layer.MediaType,
+			Digest:    layer.Digest,
+			Size:      layer.Size,
+		})
+	}
+
+	return digestSource, nil
+}
+
+// dryRunPlan resolve images and print blobs to fetch and disk space needed without downloading blobs,
+// it fails if there isn't enough space
+func (d *Dp) dryRunPlan() error {
+	for _, image := range d.images {
+		d.image = image
+		if _, err := d.resolveBlobs(); err != nil {
+			return err
+		}
+	}
+	d.image = d.images[0]
+
+	plan := d.plan()
+	d.printPlan(plan)
+
+	return plan.check()
+}
+
+// plan sum blobs of resolved images, blobs shared by images are fetched once
+func (d *Dp) plan() *pullPlan {
+	var (
+		plan    pullPlan
+		seen    = make(map[string]struct{})
+		largest int64
+	)
+	for _, image := range d.images {
+		for index, blob := range image.blobs {
+			if _, ok := d.exclude[blob.Digest]; ok {
+				continue
+			}
+			if _, ok := seen[blob.Digest]; ok {
+				continue
+			}
+			seen[blob.Digest] = struct{}{}
+
+			cached := d.cache != nil && d.cache.Has(blob.Digest)
+			plan.blobs = append(plan.blobs, planBlob{Descriptor: blob, image: image, cached: cached})
+			if cached {
+				plan.cached += blob.Size
+			} else {
+				plan.download += blob.Size
+				largest = max(largest, blob.Size)
+			}
+			if index > 0 {
+				plan.uncompressed += uncompressedSize(blob)
+			}
+		}
+	}
+
+	switch {
+	case d.engine != nil || d.image.output == Stdout:
+	case d.image.format == archive.FormatDocker && d.compression == compress.None:
+		plan.output = plan.uncompressed
+	default:
+		// layers are kept compressed in OCI, and compressed again in compressed docker-archive
+		plan.output = plan.cached + plan.download
+	}
+
+	// blobs are downloaded to blob cache, or to temporary folder one at a time without cache
+	work, need := d.tempDir, largest
+	if d.cache != nil {
+		work, need = d.cache.Root(), plan.download
+	}
+	if d.offline {
+		need = 0
+	}
+	if err := plan.addDisk(work, need); err != nil {
+		d.log.Warnf("check free space of %s: %s", work, err)
+	}
+	if plan.output > 0 {
+		output := filepath.Dir(d.outputPath())
+		if err := plan.addDisk(output, plan.output); err != nil {
+			d.log.Warnf("check free space of %s: %s", output, err)
+		}
+	}
+
+	return &plan
+}
+
+// addDisk add space needed in path, which is merged with the one on the same filesystem
+func (p *pullPlan) addDisk(path string, need int64) error {
+	free, device, err := tools.DiskFree(path)
+	if err != nil {
+		return err
+	}
+	for index := range p.disks {
+		if p.disks[index].device == device {
+			p.disks[index].need += need
+			return nil
+		}
+	}
+
+	p.disks = append(p.disks, planDisk{path: path, device: device, free: free, need: need})
+	return nil
+}
+
+// check fail if any filesystem doesn't have enough free space
+func (p *pullPlan) check() error {
+	var errs []error
+	for _, disk := range p.disks {
+		if disk.need > disk.free {
+			errs = append(errs, fmt.Errorf("%w: %s needs %s, only %s is free",
+				tools.ErrNoSpace, disk.path, tools.HumanSize(disk.need), tools.HumanSize(disk.free)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// printPlan print blobs of plan grouped by image, sizes and free space
+func (d *Dp) printPlan(p *pullPlan) {
+	w := d.out
+	var image *Image
+	for _, blob := range p.blobs {
+		if blob.image != image {
+			image = blob.image
+			fmt.Fprintf(w, "%s %s: %s\n", image.ref, image.arch, image.digest)
+		}
+		state := "download"
+		if blob.cached {
+			state = "cached"
+		}
+		fmt.Fprintf(w, "  %s %10s  %s\n", blob.Digest, tools.HumanSize(blob.Size), state)
+	}
+
+	fmt.Fprintf(w, "download: %s, cached: %s\n", tools.HumanSize(p.download), tools.HumanSize(p.cached))
+	fmt.Fprintf(w, "estimated uncompressed size: %s\n", tools.HumanSize(p.uncompressed))
+	if p.output > 0 {
+		fmt.Fprintf(w, "estimated output: %s %s\n", d.outputPath(), tools.HumanSize(p.output))
+	}
+	for _, disk := range p.disks {
+		fmt.Fprintf(w, "disk %s: needs %s, %s free\n", disk.path, tools.HumanSize(disk.need), tools.HumanSize(disk.free))
+	}
+}
+
+// uncompressedSize estimate size of layer after decompression
+func uncompressedSize(layer http.Descriptor) int64 {
+	if strings.HasSuffix(layer.MediaType, "gzip") || strings.HasSuffix(layer.MediaType, "zstd") {
+		return int64(float64(layer.Size) * uncompressedRatio)
+	}
+
+	return layer.Size
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const octetStream = "application/octet-stream"
+
+// pusher push blobs and manifests to repository of registry with distribution API
+type pusher struct {
+	client   *http.Client
+	log      *logger
+	out      io.Writer
+	ref      *tools.Reference
+	endpoint string
+	cred     *credential
+	// chunkSize blobs larger than it are uploaded with chunks, 0 means monolithic upload
+	chunkSize int64
+
+	challenge   *http.Challenge
+	token       string
+	tokenExpiry time.Time
+	// scopes of token, which include pull of repositories blobs are mounted from
+	scopes []string
+
+	// store records repositories of registry which blobs are in, blobs are mounted from them
+	store *cache.Store
+	// locations repositories of registry which blobs are known to be in by current run
+	locations map[string][]string
+}
+
+// newPusher create pusher of repository of ref, credential saved by `docker login` is used if credentials is empty
+func newPusher(d *Dp, ref *tools.Reference, credentials string, chunkSize int64) (*pusher, error) {
+	cred, err := lookupCredential(credentials, ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pusher{
+		client:    d.client,
+		log:       d.log,
+		out:       d.out,
+		ref:       ref,
+		endpoint:  d.endpoint(ref),
+		cred:      cred,
+		chunkSize: chunkSize,
+		store:     d.cache,
+		locations: make(map[string][]string),
+	}, nil
+}
+
+// login request token with pull and push permission of repository, token is empty if registry doesn't require it
+func (p *pusher) login() error {
+	r, err := p.client.Send(context.Background(), nethttp.MethodGet, p.endpoint+"/v2/")
+	if err != nil {
+		return err
+	}
+	if r.Code() != nethttp.StatusUnauthorized {
+		return checkResponse(r)
+	}
+
+	p.challenge = http.ParseChallenge(r.Header.Get(WwwAuthenticate))
+	if p.challenge == nil {
+		return fmt.Errorf("registry %s requires authentication without challenge", p.ref.Registry)
+	}
+	if !p.challenge.IsBearer() {
+		if p.cred == nil {
+			return fmt.Errorf("registry %s requires credential", p.ref.Registry)
+		}
+		return nil
+	}
+
+	p.scopes = []string{fmt.Sprintf("repository:%s:pull,push", p.ref.Repository)}
+	return p.requestToken()
+}
+
+// requestToken request token of all scopes from realm of challenge
+func (p *pusher) requestToken() error {
+	token, err := requestToken(p.client, p.challenge, p.cred, p.scopes...)
+	if err != nil {
+		return err
+	}
+	p.token = token.Token
+	p.tokenExpiry = token.Expiry(time.Now())
+	p.log.Debugf("token of %v: %#v", p.scopes, token)
+
+	return nil
+}
+
+// authorizePull add pull of repository to scopes of token, which is required to mount blob from it
+func (p *pusher) authorizePull(repository string) error {
+	if p.challenge == nil || !p.challenge.IsBearer() {
+		return nil
+	}
+
+	scope := fmt.Sprintf("repository:%s:pull", repository)
+	if slices.Contains(p.scopes, scope) {
+		return nil
+	}
+	p.scopes = append(p.scopes, scope)
+
+	return p.requestToken()
+}
+
+// auth return options to authorize request with token or basic credential
+func (p *pusher) auth(opts ...http.HeaderOption) []http.HeaderOption {
+	if p.token != "" {
+		return append(opts, http.SetAuthToken(p.token))
+	}
+	if p.cred != nil && p.challenge != nil {
+		return append(opts, http.SetBasicAuth(p.cred.username, p.cred.password))
+	}
+
+	return opts
+}
+
+func (p *pusher) url(kind, reference string) string {
+	return fmt.Sprintf(registryUrl, p.endpoint, p.ref.Repository, kind, reference)
+}
+
+func (p *pusher) send(method, url string, opts ...http.HeaderOption) (*http.Response, error) {
+	if !p.tokenExpiry.IsZero() && time.Until(p.tokenExpiry) <= tokenRenewMargin {
+		p.log.Debugf("token of %v expires at %s, request a new one", p.scopes, p.tokenExpiry)
+		if err := p.requestToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.log.Debugf("send %s request with url: %s", method, url)
+	r, err := p.client.Send(context.Background(), method, url, p.auth(opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	p.log.Debugf("response status code: %d", r.Code())
+
+	return r, nil
+}
+
+// blobExists check whether blob is in repository already
+func (p *pusher) blobExists(digest string) (bool, error) {
+	r, err := p.send(nethttp.MethodHead, p.url(BLOBS, digest))
+	if err != nil {
+		return false, err
+	}
+	switch r.Code() {
+	case nethttp.StatusOK:
+		return true, nil
+	case nethttp.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("check blob %s: unexpected status code %d", digest, r.Code())
+}
+
+// pushBlob upload blob unless it's in repository, blob is opened only when it's uploaded
+func (p *pusher) pushBlob(desc http.Descriptor, open func() (io.ReadCloser, error)) error {
+	exists, err := p.blobExists(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(p.out, "blob exists: %s\n", desc.Digest[7:])
+		p.addLocation(p.ref.Repository, desc.Digest)
+		return nil
+	}
+
+	location, err := p.mount(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if location == "" {
+		p.addLocation(p.ref.Repository, desc.Digest)
+		return nil
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fmt.Fprintf(p.out, "pushing blob: %s\n", desc.Digest[7:])
+	if p.chunkSize > 0 && desc.Size > p.chunkSize {
+		err = p.uploadChunks(location, desc, r)
+	} else {
+		err = p.finishUpload(location, desc.Digest, http.SetBody(r, desc.Size))
+	}
+	if err != nil {
+		return err
+	}
+
+	p.addLocation(p.ref.Repository, desc.Digest)
+	return nil
+}
+
+// mount try to mount blob from another repository of registry which blob is known to be in,
+// location of upload session is returned if blob isn't mounted
+func (p *pusher) mount(digest string) (string, error) {
+	from := p.mountSource(digest)
+	if from == "" {
+		return p.startUpload()
+	}
+
+	if err := p.authorizePull(from); err != nil {
+		p.log.Warnf("request token to mount from %s: %s", from, err)
+		return p.startUpload()
+	}
+	query := url.Values{"mount": {digest}, "from": {from}}
+	r, err := p.send(nethttp.MethodPost, p.url(BLOBS, "uploads/")+"?"+query.Encode())
+	if err != nil {
+		return "", err
+	}
+
+	switch r.Code() {
+	case nethttp.StatusCreated:
+		fmt.Fprintf(p.out, "mounted blob from %s: %s\n", from, digest[7:])
+		return "", nil
+	case nethttp.StatusAccepted:
+		// mount is refused, registry starts upload session instead
+		p.log.Debugf("mount %s from %s is refused", digest, from)
+		return p.location(r)
+	}
+
+	p.log.Debugf("mount %s from %s: unexpected status code %d", digest, from, r.Code())
+	return p.startUpload()
+}
+
+// startUpload start upload session and return its location
+func (p *pusher) startUpload() (string, error) {
+	r, err := p.send(nethttp.MethodPost, p.url(BLOBS, "uploads/"))
+	if err != nil {
+		return "", err
+	}
+	if r.Code() != nethttp.StatusAccepted {
+		return "", fmt.Errorf("start upload: unexpected status code %d: %s", r.Code(), r.Body())
+	}
+
+	return p.location(r)
+}
+
+// mountSource return the latest repository other than destination which blob is known to be in
+func (p *pusher) mountSource(digest string) string {
+	repositories := p.locations[digest]
+	if p.store != nil {
+		repositories = append(repositories, p.store.Locations(p.ref.Registry, digest)...)
+	}
+	for _, repository := range repositories {
+		if repository != p.ref.Repository {
+			return repository
+		}
+	}
+
+	return ""
+}
+
+// addLocation record that blob is in repository of registry
+func (p *pusher) addLocation(repository, digest string) {
+	if !slices.Contains(p.locations[digest], repository) {
+		p.locations[digest] = append([]string{repository}, p.locations[digest]...)
+	}
+	if p.store == nil {
+		return
+	}
+	if err := p.store.AddLocation(p.ref.Registry, repository, digest); err != nil {
+		p.log.Warnf("record location of blob %s: %s", digest, err)
+	}
+}
+
+// uploadChunks upload blob with chunks of chunkSize, then complete upload
+func (p *pusher) uploadChunks(location string, desc http.Descriptor, r io.Reader) error {
+	chunk := make([]byte, p.chunkSize)
+	var offset int64
+	for offset < desc.Size {
+		n, err := io.ReadFull(r, chunk[:min(p.chunkSize, desc.Size-offset)])
+		if err != nil {
+			return fmt.Errorf("read blob %s: %w", desc.Digest, err)
+		}
+
+		response, err := p.send(nethttp.MethodPatch, location,
+			http.SetBody(bytes.NewReader(chunk[:n]), int64(n)),
+			http.SetHeader("Content-Type", octetStream),
+			http.SetHeader("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(n)-1)),
+		)
+		if err != nil {
+			return err
+		}
+		if response.Code() != nethttp.StatusAccepted {
+			return fmt.Errorf("upload chunk of %s: unexpected status code %d: %s", desc.Digest, response.Code(), response.Body())
+		}
+		if location, err = p.location(response); err != nil {
+			return err
+		}
+		offset += int64(n)
+		p.log.Debugf("uploaded %d/%d of %s", offset, desc.Size, desc.Digest)
+	}
+
+	return p.finishUpload(location, desc.Digest)
+}
+
+// finishUpload complete upload with PUT, which carries the whole blob for monolithic upload
+func (p *pusher) finishUpload(location, digest string, opts ...http.HeaderOption) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("digest", digest)
+	u.RawQuery = query.Encode()
+
+	r, err := p.send(nethttp.MethodPut, u.String(), append(opts, http.SetHeader("Content-Type", octetStream))...)
+	if err != nil {
+		return err
+	}
+	if r.Code() != nethttp.StatusCreated {
+		return fmt.Errorf("upload blob %s: unexpected status code %d: %s", digest, r.Code(), r.Body())
+	}
+
+	return nil
+}
+
+// location return absolute url of upload session in response
+func (p *pusher) location(r *http.Response) (string, error) {
+	location := r.Header.Get("Location")
+	if location == "" {
+		return "", errors.New("registry doesn't return location of upload")
+	}
+
+	base, err := url.Parse(p.endpoint)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+// pushManifest put manifest or index with reference, which is tag or digest
+func (p *pusher) pushManifest(reference, mediaType string, content []byte) error {
+	r, err := p.send(nethttp.MethodPut, p.url(MANIFESTS, reference),
+		http.SetBody(bytes.NewReader(content), int64(len(content))),
+		http.SetHeader("Content-Type", mediaType),
+	)
+	if err != nil {
+		return err
+	}
+	if r.Code() != nethttp.StatusCreated {
+		return fmt.Errorf("put manifest %s: unexpected status code %d: %s", reference, r.Code(), r.Body())
+	}
+
+	return nil
+}
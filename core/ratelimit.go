@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const (
+	// rateLimitPreview is the repository docker suggest to check quota, HEAD request to it doesn't count
+	rateLimitPreview = "ratelimitpreview/test:latest"
+	// defaultRateLimitWait used when registry doesn't tell us how long to wait
+	defaultRateLimitWait = time.Minute
+	// maxRateLimitRetries give up after waiting so many times, so registry keeping 429 can't hang pull
+	maxRateLimitRetries = 5
+)
+
+// sleep replaced in tests
+var sleep = time.Sleep
+
+// CheckRateLimit query remaining pull quota of docker hub without pulling any image
+func CheckRateLimit(cfg *Config) (*http.RateLimit, error) {
+	config := *cfg
+	config.Name = rateLimitPreview
+	d, err := NewDp(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.RateLimit()
+}
+
+// RateLimit send HEAD request to manifest of current image and read rate limit headers
+func (d *Dp) RateLimit() (*http.RateLimit, error) {
+	if err := d.authorize(d.image); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf(registryUrl, d.registryEndpoint(), d.image.ref.Repository, MANIFESTS, d.image.ref.Reference())
+	d.log.Debugf("send HEAD request with url: %s", url)
+	r, err := d.client.Head(context.Background(), url, http.SetAccept(AcceptRefresh), d.image.authorization())
+	if err != nil {
+		d.log.Error(err)
+		return nil, err
+	}
+
+	d.recordRateLimit(r)
+	if d.rateLimit == nil {
+		return nil, tools.ErrNoRateLimit
+	}
+
+	return d.rateLimit, nil
+}
+
+// recordRateLimit keep the latest quota reported by registry
+func (d *Dp) recordRateLimit(r *http.Response) {
+	rl, ok := r.RateLimit()
+	if !ok {
+		return
+	}
+
+	d.rateLimit = rl
+	d.log.Debugf("rate limit: %s", rl)
+	if rl.Remaining == 0 {
+		d.log.Warnf("rate limit exhausted: %s", rl)
+	}
+}
+
+// rateLimitWait return how long to sleep before retry, or error if waiting isn't enabled or
+// registry is still limiting after retries
+func (d *Dp) rateLimitWait(r *http.Response, retries int) (time.Duration, error) {
+	if retries >= maxRateLimitRetries {
+		return 0, fmt.Errorf("%w: still limited after %d retries", tools.ErrRateLimited, retries)
+	}
+	if !d.waitRateLimit {
+		if d.rateLimit != nil {
+			return 0, fmt.Errorf("%w: %s", tools.ErrRateLimited, d.rateLimit)
+		}
+		return 0, tools.ErrRateLimited
+	}
+
+	if wait, ok := http.ParseRetryAfter(r.Header, time.Now()); ok && wait > 0 {
+		return wait, nil
+	}
+	if d.rateLimit != nil && d.rateLimit.Window > 0 {
+		return d.rateLimit.Window, nil
+	}
+
+	return defaultRateLimitWait, nil
+}
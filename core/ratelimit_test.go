@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anoyah/downer/tools"
+)
+
+// rateLimitedDp return Dp requesting server which responds with statuses in order, and sleeps recorded
+func rateLimitedDp(t *testing.T, statuses ...int) (*Dp, *[]time.Duration) {
+	t.Helper()
+
+	var requests int
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		status := statuses[min(requests, len(statuses)-1)]
+		if status == nethttp.StatusTooManyRequests && requests == 0 {
+			w.Header().Set("Retry-After", "7")
+		}
+		requests++
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	d, err := newRemote(&Config{NoCache: true, Insecure: []string{host}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.waitRateLimit = true
+	ref, err := tools.ParseReference(host + "/library/nginx:alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.image = &Image{ref: ref}
+	return d, &slept
+}
+
+func TestRateLimitWait(t *testing.T) {
+	// Retry-After is used first, then the default wait as registry doesn't report window
+	d, slept := rateLimitedDp(t, nethttp.StatusTooManyRequests, nethttp.StatusTooManyRequests, nethttp.StatusOK)
+	r, err := d.manifestsRequest("alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Code() != nethttp.StatusOK {
+		t.Fatalf("unexpected status: %d", r.Code())
+	}
+	if !slices.Equal(*slept, []time.Duration{7 * time.Second, defaultRateLimitWait}) {
+		t.Fatalf("unexpected waits: %v", *slept)
+	}
+
+	// registry keeping 429 gives up after retries
+	d, slept = rateLimitedDp(t, nethttp.StatusTooManyRequests)
+	if _, err := d.manifestsRequest("alpine"); !errors.Is(err, tools.ErrRateLimited) {
+		t.Fatalf("expected rate limited error, got %v", err)
+	}
+	if len(*slept) != maxRateLimitRetries {
+		t.Fatalf("unexpected retries: %d", len(*slept))
+	}
+
+	// without waiting it fails at once
+	d, slept = rateLimitedDp(t, nethttp.StatusTooManyRequests, nethttp.StatusOK)
+	d.waitRateLimit = false
+	if _, err := d.manifestsRequest("alpine"); !errors.Is(err, tools.ErrRateLimited) || len(*slept) != 0 {
+		t.Fatalf("expected rate limited error without waiting, got %v after %d waits", err, len(*slept))
+	}
+}
+
+func TestCheckRateLimitKeepsConfig(t *testing.T) {
+	cfg := &Config{Name: "nginx:alpine", NoCache: true, Proxy: "http://127.0.0.1:1"}
+	CheckRateLimit(cfg)
+	if cfg.Name != "nginx:alpine" {
+		t.Fatalf("config of caller is changed: %s", cfg.Name)
+	}
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anoyah/downer/cache"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const DockerContentDigest = "Docker-Content-Digest"
+
+// tokenRenewMargin token expiring within it is renewed before request, so it doesn't expire during download
+const tokenRenewMargin = 30 * time.Second
+
+// authenticate request token of current image with challenge of registry, token is empty if registry
+// doesn't require it, and credential is returned instead if registry issues Basic challenge
+func (d *Dp) authenticate() (*http.TokenInfo, *credential, error) {
+	challenge, err := d.getChallenge(d.image.ref.Repository, d.image.ref.Reference())
+	if err != nil {
+		d.log.Errorf("get challenge: %s", err)
+		return nil, nil, err
+	}
+	if challenge == nil {
+		d.log.Debugf("registry %s doesn't require token", d.image.ref.Registry)
+		return &http.TokenInfo{}, nil, nil
+	}
+	d.log.Debugf("challenge: %#v", challenge)
+
+	cred, err := lookupCredential(d.credentials, d.image.ref.Registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !challenge.IsBearer() {
+		if cred == nil {
+			return nil, nil, fmt.Errorf("registry %s requires credential", d.image.ref.Registry)
+		}
+		return &http.TokenInfo{}, cred, nil
+	}
+
+	scope := challenge.Params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", d.image.ref.Repository)
+	}
+	token, err := requestToken(d.client, challenge, cred, scope)
+	if err != nil {
+		d.log.Errorf("request token: %s", err)
+		return nil, nil, err
+	}
+	d.log.Debugf("token info: %#v", token)
+
+	return token, nil, nil
+}
+
+// requestToken request token of scopes from realm of challenge, credential is sent to realm if it's set
+func requestToken(client *http.Client, challenge *http.Challenge, cred *credential, scopes ...string) (*http.TokenInfo, error) {
+	var opts []http.HeaderOption
+	if cred != nil {
+		opts = append(opts, http.SetBasicAuth(cred.username, cred.password))
+	}
+	r, err := client.Send(context.Background(), nethttp.MethodGet, challenge.TokenUrl(scopes...), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(r); err != nil {
+		return nil, fmt.Errorf("request token of %s: %w", strings.Join(scopes, " "), err)
+	}
+
+	var token http.TokenInfo
+	if err := json.Unmarshal(r.Body(), &token); err != nil {
+		return nil, err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	return &token, nil
+}
+
+// authorization return option authorizing request of image with token, or with credential if
+// registry uses basic authentication
+func (i *Image) authorization() http.HeaderOption {
+	if i.cred != nil {
+		return http.SetBasicAuth(i.cred.username, i.cred.password)
+	}
+
+	return http.SetAuthToken(i.token)
+}
+
+// registryEndpoint return base url of registry of current image
+func (d *Dp) registryEndpoint() string {
+	return d.endpoint(d.image.ref)
+}
+
+// endpoint return base url of registry of reference, insecure registries are served with plain http
+func (d *Dp) endpoint(ref *tools.Reference) string {
+	_, insecure := d.insecure[ref.Registry]
+	return registryEndpoint(ref, insecure)
+}
+
+// registryEndpoint return base url of registry, Docker Hub is served by `registry-1.docker.io`
+func registryEndpoint(ref *tools.Reference, insecure bool) string {
+	if ref.Registry == tools.DefaultRegistry {
+		return dockerHubUrl
+	}
+	if insecure {
+		return "http://" + ref.Registry
+	}
+
+	return "https://" + ref.Registry
+}
+
+// insecureHosts return set of hosts of insecure registries
+func insecureHosts(hosts []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "http://"), "https://")
+		set[strings.TrimSuffix(host, "/")] = struct{}{}
+	}
+
+	return set
+}
+
+// repoTags return names of image in archive, which are tags specified by user or the familiar reference
+func (d *Dp) repoTags() []string {
+	if len(d.image.tags) > 0 {
+		tags := make([]string, 0, len(d.image.tags))
+		for _, tag := range d.image.tags {
+			ref, err := tools.ParseReference(tag)
+			if err != nil || ref.Tag == "" {
+				continue
+			}
+			tags = append(tags, ref.FamiliarName()+":"+ref.Tag)
+		}
+		return tags
+	}
+
+	if d.image.ref.Tag == "" {
+		return nil
+	}
+
+	return []string{d.image.ref.FamiliarName() + ":" + d.image.ref.Tag}
+}
+
+// fileTag return tag used in file name, short digest if image is referenced by digest
+func (d *Dp) fileTag() string {
+	if d.image.tag != "" {
+		return d.image.tag
+	}
+
+	return d.image.ref.Digest[7:19]
+}
+
+// manifestDigest return digest of manifest in response, compute it if registry doesn't report
+func manifestDigest(r *http.Response) string {
+	if digest := r.Header.Get(DockerContentDigest); digest != "" {
+		return digest
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(r.Body()))
+}
+
+// checkResponse return error if registry doesn't respond successfully
+func checkResponse(r *http.Response) error {
+	if r.Code() >= nethttp.StatusOK && r.Code() < nethttp.StatusMultipleChoices {
+		return nil
+	}
+
+	return fmt.Errorf("unexpected status code %d: %s", r.Code(), r.Body())
+}
+
+// isManifest check whether content is image manifest rather than index
+func isManifest(content []byte) bool {
+	var probe struct {
+		Config    json.RawMessage `json:"config"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(content, &probe); err != nil {
+		return false
+	}
+
+	return probe.Config != nil && probe.Manifests == nil
+}
+
+func parseManifest(content []byte) (*http.Manifest, error) {
+	var data http.Manifest
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// newRemote create Dp with client, credentials and blob cache of config, which requests registries
+// for images set later rather than images of config
+func newRemote(cfg *Config) (*Dp, error) {
+	log, err := newLogger(cfg.Debug)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseCredential(cfg.Credentials); err != nil {
+		return nil, err
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dp{
+		client:      client,
+		log:         log,
+		out:         os.Stdout,
+		credentials: cfg.Credentials,
+		insecure:    insecureHosts(cfg.Insecure),
+	}
+	if !cfg.NoCache {
+		if d.cache, err = cache.Open(cfg.CacheDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// use point current image to reference and request its token
+func (d *Dp) use(ref *tools.Reference) error {
+	d.image = &Image{ref: ref, name: ref.ShortName(), tag: ref.Tag}
+	return d.authorize(d.image)
+}
+
+// authorize request token of image, which is used until it expires or registry rejects it
+func (d *Dp) authorize(image *Image) error {
+	current := d.image
+	d.image = image
+	defer func() { d.image = current }()
+
+	token, cred, err := d.authenticate()
+	if err != nil {
+		return err
+	}
+	image.token, image.cred = token.Token, cred
+	image.tokenExpiry = token.Expiry(time.Now())
+
+	return nil
+}
+
+// renewToken request token of image again if it expires within tokenRenewMargin
+func (d *Dp) renewToken(image *Image) error {
+	if image.tokenExpiry.IsZero() || time.Until(image.tokenExpiry) > tokenRenewMargin {
+		return nil
+	}
+	d.log.Debugf("token of %s expires at %s, request a new one", image.ref, image.tokenExpiry)
+
+	return d.authorize(image)
+}
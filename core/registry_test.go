@@ -0,0 +1,75 @@
+package core
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestRepoTags(t *testing.T) {
+	cases := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"nginx:alpine", nil, []string{"nginx:alpine"}},
+		{"neosmemo/memos:stable", nil, []string{"neosmemo/memos:stable"}},
+		{"ghcr.io/org/app:1", nil, []string{"ghcr.io/org/app:1"}},
+		{"nginx:alpine", []string{"registry.local/nginx:1", "docker.io/library/nginx:latest"}, []string{"registry.local/nginx:1", "nginx:latest"}},
+	}
+	for _, c := range cases {
+		d, err := NewDp(&Config{Arch: "linux/amd64", Name: c.name, Tags: c.tags, NoCache: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.repoTags(); !slices.Equal(got, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	if _, err := NewDp(&Config{Name: "nginx", Tags: []string{"Invalid Tag"}, NoCache: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.basic = "user:secret"
+	seedRegistry(t, registry, "library/nginx", "alpine")
+
+	newDp := func(credentials string) *Dp {
+		d, err := NewDp(&Config{
+			Name:        registry.host() + "/library/nginx:alpine",
+			Arch:        "linux/amd64",
+			NoCache:     true,
+			Insecure:    []string{registry.host()},
+			Credentials: credentials,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.out = io.Discard
+		d.image = d.images[0]
+		return d
+	}
+
+	d := newDp("user:secret")
+	clean, err := d.init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clean()
+	pulled, err := d.pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pulled.Layers[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	if _, err := newDp("user:wrong").resolve(); err == nil {
+		t.Fatal("expected error of wrong credential")
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+type (
+	// Resolver resolve references to digests without downloading layers, it isn't safe for concurrent use
+	Resolver struct {
+		d *Dp
+	}
+
+	// Resolved digest of manifest or index which reference points to
+	Resolved struct {
+		// Reference full reference, such as `docker.io/library/nginx:alpine`
+		Reference string `json:"reference"`
+		Digest    string `json:"digest"`
+		MediaType string `json:"mediaType,omitempty"`
+		// Platforms manifests of platforms, which are only resolved by ResolvePlatforms
+		Platforms []ResolvedPlatform `json:"platforms,omitempty"`
+	}
+
+	// ResolvedPlatform manifest of platform, such as `linux/arm64/v8`
+	ResolvedPlatform struct {
+		Platform  string `json:"platform"`
+		Digest    string `json:"digest"`
+		MediaType string `json:"mediaType,omitempty"`
+		Size      int64  `json:"size,omitempty"`
+	}
+)
+
+// NewResolver create resolver with client and credentials of config, blob cache isn't used
+func NewResolver(cfg *Config) (*Resolver, error) {
+	config := *cfg
+	config.NoCache = true
+	d, err := newRemote(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{d: d}, nil
+}
+
+// Resolve return digest which reference points to now, with one HEAD request if registry reports
+// `Docker-Content-Digest`, otherwise manifest is requested and hashed
+func (r *Resolver) Resolve(reference string) (*Resolved, error) {
+	ref, err := tools.ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.d.use(ref); err != nil {
+		return nil, err
+	}
+
+	digest, mediaType, err := r.d.headManifest(ref.Reference())
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" && digest != ref.Digest {
+		return nil, fmt.Errorf("%w: %s is %s", tools.ErrChecksumMismatch, ref, digest)
+	}
+
+	return &Resolved{Reference: ref.String(), Digest: digest, MediaType: mediaType}, nil
+}
+
+// ResolvePlatforms resolve reference and digests of manifests of its platforms, platform of
+// single manifest is read from its config
+func (r *Resolver) ResolvePlatforms(reference string) (*Resolved, error) {
+	resolved, err := r.Resolve(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	d := r.d
+	response, err := d.manifestsRequest(resolved.Digest, http.SetAccept(AcceptRefresh), d.image.authorization())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(response); err != nil {
+		return nil, err
+	}
+	content := response.Body()
+	if digest := manifestDigest(response); digest != resolved.Digest {
+		return nil, fmt.Errorf("%w: manifest %s is %s", tools.ErrChecksumMismatch, resolved.Digest, digest)
+	}
+
+	if !isManifest(content) {
+		var index http.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("parse index: %w", err)
+		}
+		for _, desc := range index.Manifests {
+			if desc.Platform == nil || desc.Platform.OS == UNKNOWN {
+				// attestations are attached to index as unknown platform
+				continue
+			}
+			resolved.Platforms = append(resolved.Platforms, ResolvedPlatform{
+				Platform:  desc.Platform.String(),
+				Digest:    desc.Digest,
+				MediaType: desc.MediaType,
+				Size:      desc.Size,
+			})
+		}
+		return resolved, nil
+	}
+
+	manifest, err := parseManifest(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := d.downloadBlob(d.image, manifest.Config.Digest, manifest.Config.MediaType, &buf); err != nil {
+		return nil, fmt.Errorf("download config: %w", err)
+	}
+	var config http.ImageConfig
+	if err := json.Unmarshal(buf.Bytes(), &config); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	resolved.Platforms = []ResolvedPlatform{{
+		Platform:  config.Platform().String(),
+		Digest:    resolved.Digest,
+		MediaType: contentMediaType(resolved.MediaType, content),
+		Size:      int64(len(content)),
+	}}
+
+	return resolved, nil
+}
+
+// headManifest return digest and media type of manifest of reference with HEAD request, which isn't
+// counted as pull by Docker Hub, manifest is requested and hashed if registry doesn't report its digest
+func (d *Dp) headManifest(reference string) (string, string, error) {
+	url := fmt.Sprintf(registryUrl, d.registryEndpoint(), d.image.ref.Repository, MANIFESTS, reference)
+	d.log.Debugf("send HEAD request with url: %s", url)
+	r, err := d.client.Head(context.Background(), url, http.SetAccept(AcceptRefresh), d.image.authorization())
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkResponse(r); err != nil {
+		return "", "", fmt.Errorf("head manifest %s: %w", reference, err)
+	}
+	if digest := r.Header.Get(DockerContentDigest); digest != "" {
+		return digest, r.Header.Get("Content-Type"), nil
+	}
+
+	d.log.Debugf("registry doesn't report digest of %s, request manifest", reference)
+	r, err = d.manifestsRequest(reference, http.SetAccept(AcceptRefresh), d.image.authorization())
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkResponse(r); err != nil {
+		return "", "", err
+	}
+	return manifestDigest(r), contentMediaType(r.Header.Get("Content-Type"), r.Body()), nil
+}
@@ -0,0 +1,50 @@
+package core
+
+import "testing"
+
+func TestResolver(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.auth = true
+	image := seedRegistry(t, registry, "library/nginx", "alpine")
+	registry.tag("library/nginx", "amd64", image.manifest, "application/vnd.oci.image.manifest.v1+json")
+
+	resolver, err := NewResolver(&Config{Insecure: []string{registry.host()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := resolver.Resolve(registry.host() + "/library/nginx:alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Digest != image.index || resolved.MediaType != "application/vnd.oci.image.index.v1+json" || resolved.Platforms != nil {
+		t.Fatalf("unexpected resolved: %+v", resolved)
+	}
+
+	resolved, err = resolver.ResolvePlatforms(registry.host() + "/library/nginx:alpine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved.Platforms) != 1 || resolved.Platforms[0].Platform != "linux/amd64" || resolved.Platforms[0].Digest != image.manifest {
+		t.Fatalf("unexpected platforms: %+v", resolved.Platforms)
+	}
+
+	// platform of single manifest is read from config, digest is hashed without Docker-Content-Digest
+	registry.hideDigest = true
+	resolved, err = resolver.ResolvePlatforms(registry.host() + "/library/nginx:amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Digest != image.manifest || len(resolved.Platforms) != 1 || resolved.Platforms[0].Platform != "linux/amd64" {
+		t.Fatalf("unexpected resolved: %+v", resolved)
+	}
+
+	if _, err = resolver.Resolve(registry.host() + "/library/nginx:missing"); err == nil {
+		t.Fatal("expected error of missing tag")
+	}
+	// digest pins tag, which points to index
+	resolved, err = resolver.Resolve(registry.host() + "/library/nginx:alpine@" + image.manifest)
+	if err != nil || resolved.Digest != image.manifest {
+		t.Fatalf("unexpected resolved: %+v, %v", resolved, err)
+	}
+}
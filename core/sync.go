@@ -0,0 +1,639 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const (
+	// AnnotationSourceDigest digest of upstream index which index of selected platforms is synced from
+	AnnotationSourceDigest = "io.github.anoyah.downer.source.digest"
+
+	SyncCopied    = "copied"
+	SyncUpdated   = "updated"
+	SyncUnchanged = "unchanged"
+	SyncPruned    = "pruned"
+	SyncFailed    = "failed"
+)
+
+type (
+	// SyncConfig config of mirroring repositories listed in sync file
+	SyncConfig struct {
+		// Config options of client and blob cache, Credentials is used for source registries
+		Config
+		// File path of YAML sync file
+		File string
+		// Report write JSON report to it, which overrides report of sync file
+		Report string
+		// DestCredentials `user:password` of destination registry, credential saved by `docker login` is used if it's empty
+		DestCredentials string
+		// ChunkSize upload blobs larger than it with chunks, such as `16M`
+		ChunkSize string
+	}
+
+	// SyncFile repositories to mirror and their destination
+	SyncFile struct {
+		Destination SyncDestination `yaml:"destination"`
+		// Platforms copied of multi-platform images, all platforms are copied if it's empty
+		Platforms []string `yaml:"platforms"`
+		// Prune remove tags from destination which match filters but vanished upstream
+		Prune bool `yaml:"prune"`
+		// Report path of JSON report
+		Report string `yaml:"report"`
+		// Insecure hosts of registries served with plain http
+		Insecure     []string          `yaml:"insecure"`
+		Repositories []*SyncRepository `yaml:"repositories"`
+	}
+
+	// SyncDestination registry such as `registry.local/mirror` or directory which one of them is set,
+	// repository is mirrored to `<registry>/<name>` or OCI layout `<directory>/<name>`
+	SyncDestination struct {
+		Registry  string `yaml:"registry"`
+		Directory string `yaml:"directory"`
+	}
+
+	// SyncRepository source repository and filters of its tags, tags listed in Tags are synced, and
+	// tags matching both Regex and Semver if they are set, all tags are synced without filters
+	SyncRepository struct {
+		// Source repository such as `nginx`, `ghcr.io/org/app`
+		Source string `yaml:"source"`
+		// Name path in destination, default is repository of source such as `library/nginx`
+		Name   string   `yaml:"name"`
+		Tags   []string `yaml:"tags"`
+		Regex  string   `yaml:"regex"`
+		Semver string   `yaml:"semver"`
+		// Platforms override platforms of sync file
+		Platforms []string `yaml:"platforms"`
+		// Prune override prune of sync file
+		Prune *bool `yaml:"prune"`
+
+		ref        *tools.Reference
+		regex      *regexp.Regexp
+		constraint *tools.Constraint
+	}
+
+	// SyncReport result of sync
+	SyncReport struct {
+		Started   time.Time    `json:"started"`
+		Finished  time.Time    `json:"finished"`
+		Copied    int          `json:"copied"`
+		Unchanged int          `json:"unchanged"`
+		Pruned    int          `json:"pruned"`
+		Failed    int          `json:"failed"`
+		Results   []SyncResult `json:"results"`
+	}
+
+	// SyncResult result of tag, or repository if it fails before tags are listed
+	SyncResult struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		Action      string `json:"action"`
+		// Digest of upstream manifest or index
+		Digest string `json:"digest,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	// syncTarget destination of repository
+	syncTarget interface {
+		// sourceDigest return upstream digest which tag is synced from, empty if tag doesn't exist
+		sourceDigest(tag string) (string, error)
+		pushBlob(desc http.Descriptor, open func() (io.ReadCloser, error)) error
+		pushManifest(reference, mediaType string, content []byte) error
+		tags() ([]string, error)
+		untag(tag string) error
+		// name return destination of tag in report
+		name(tag string) string
+		close() error
+	}
+
+	registryTarget struct {
+		*pusher
+	}
+
+	layoutTarget struct {
+		*archive.Layout
+		dir      string
+		repoName string
+	}
+)
+
+// LoadSyncFile read and validate sync file
+func LoadSyncFile(path string) (*SyncFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file SyncFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if (file.Destination.Registry == "") == (file.Destination.Directory == "") {
+		return nil, errors.New("one of registry and directory of destination is required")
+	}
+	if len(file.Repositories) == 0 {
+		return nil, errors.New("no repository to sync")
+	}
+	for _, repo := range file.Repositories {
+		if repo.ref, err = tools.ParseReference(repo.Source); err != nil {
+			return nil, err
+		}
+		if repo.Name == "" {
+			repo.Name = repo.ref.Repository
+		}
+		if repo.Regex != "" {
+			if repo.regex, err = regexp.Compile(repo.Regex); err != nil {
+				return nil, fmt.Errorf("regex of %s: %w", repo.Source, err)
+			}
+		}
+		if repo.Semver != "" {
+			if repo.constraint, err = tools.ParseConstraint(repo.Semver); err != nil {
+				return nil, fmt.Errorf("semver of %s: %w", repo.Source, err)
+			}
+		}
+		for _, platform := range repo.platforms(&file) {
+			if parsePlatform(platform) == nil {
+				return nil, fmt.Errorf("invalid platform of %s: %s", repo.Source, platform)
+			}
+		}
+	}
+
+	return &file, nil
+}
+
+// match check whether tag is selected by filters
+func (r *SyncRepository) match(tag string) bool {
+	if slices.Contains(r.Tags, tag) {
+		return true
+	}
+	if r.regex == nil && r.constraint == nil {
+		return len(r.Tags) == 0
+	}
+
+	return (r.regex == nil || r.regex.MatchString(tag)) && (r.constraint == nil || r.constraint.CheckTag(tag))
+}
+
+func (r *SyncRepository) platforms(file *SyncFile) []string {
+	if len(r.Platforms) > 0 {
+		return r.Platforms
+	}
+	return file.Platforms
+}
+
+func (r *SyncRepository) prune(file *SyncFile) bool {
+	if r.Prune != nil {
+		return *r.Prune
+	}
+	return file.Prune
+}
+
+// Sync copy new or changed tags of repositories in sync file to destination, tags whose upstream
+// digest is the same as the one synced last time are skipped
+func Sync(cfg *SyncConfig) (*SyncReport, error) {
+	file, err := LoadSyncFile(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	var chunkSize int64
+	if cfg.ChunkSize != "" {
+		if chunkSize, err = tools.ParseSize(cfg.ChunkSize); err != nil {
+			return nil, err
+		}
+	}
+
+	config := cfg.Config
+	config.Insecure = append(config.Insecure, file.Insecure...)
+	d, err := newRemote(&config)
+	if err != nil {
+		return nil, err
+	}
+	clean, err := d.init()
+	if err != nil {
+		return nil, err
+	}
+	defer clean()
+
+	report := &SyncReport{Started: time.Now()}
+	for _, repo := range file.Repositories {
+		d.syncRepository(file, repo, cfg.DestCredentials, chunkSize, report)
+	}
+	report.Finished = time.Now()
+
+	if path := cmp.Or(cfg.Report, file.Report); path != "" {
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// Summary return counts of results and failures
+func (r *SyncReport) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "synced in %s: %d copied, %d unchanged, %d pruned, %d failed\n",
+		r.Finished.Sub(r.Started).Round(time.Second), r.Copied, r.Unchanged, r.Pruned, r.Failed)
+	for _, result := range r.Results {
+		if result.Action == SyncFailed {
+			fmt.Fprintf(&b, "failed %s: %s\n", result.Source, result.Error)
+		}
+	}
+	return b.String()
+}
+
+func (r *SyncReport) add(result SyncResult) {
+	switch result.Action {
+	case SyncCopied, SyncUpdated:
+		r.Copied++
+	case SyncUnchanged:
+		r.Unchanged++
+	case SyncPruned:
+		r.Pruned++
+	case SyncFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// syncRepository sync selected tags of repository, failures are recorded in report
+func (d *Dp) syncRepository(file *SyncFile, repo *SyncRepository, destCredentials string, chunkSize int64, report *SyncReport) {
+	fail := func(err error) {
+		d.log.Errorf("sync %s: %s", repo.Source, err)
+		report.add(SyncResult{Source: repo.ref.Name(), Action: SyncFailed, Error: err.Error()})
+	}
+
+	ref := *repo.ref
+	if err := d.use(&ref); err != nil {
+		fail(err)
+		return
+	}
+
+	upstream, err := d.listTags()
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, tag := range repo.Tags {
+		if !slices.Contains(upstream, tag) {
+			report.add(SyncResult{Source: ref.Name() + ":" + tag, Action: SyncFailed, Error: "tag isn't found upstream"})
+		}
+	}
+
+	target, err := d.syncTarget(file, repo, destCredentials, chunkSize)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer func() {
+		if err := target.close(); err != nil {
+			fail(err)
+		}
+	}()
+
+	fmt.Fprintf(d.out, "sync %s to %s\n", ref.Name(), target.name(""))
+	for _, tag := range upstream {
+		if !repo.match(tag) {
+			continue
+		}
+		report.add(d.syncTag(target, repo.platforms(file), tag))
+	}
+
+	if !repo.prune(file) {
+		return
+	}
+	tags, err := target.tags()
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, tag := range tags {
+		if !repo.match(tag) || slices.Contains(upstream, tag) {
+			continue
+		}
+		result := SyncResult{Source: ref.Name() + ":" + tag, Destination: target.name(tag), Action: SyncPruned}
+		if err := target.untag(tag); err != nil {
+			result.Action, result.Error = SyncFailed, fmt.Sprintf("prune: %s", err)
+		} else {
+			fmt.Fprintf(d.out, "pruned %s\n", target.name(tag))
+		}
+		report.add(result)
+	}
+}
+
+// syncTarget return destination of repository
+func (d *Dp) syncTarget(file *SyncFile, repo *SyncRepository, credentials string, chunkSize int64) (syncTarget, error) {
+	if file.Destination.Directory != "" {
+		dir := filepath.Join(file.Destination.Directory, filepath.FromSlash(repo.Name))
+		layout, err := archive.OpenLayout(dir)
+		if err != nil {
+			return nil, err
+		}
+		return &layoutTarget{Layout: layout, dir: dir, repoName: repo.ref.FamiliarName()}, nil
+	}
+
+	ref, err := tools.ParseReference(strings.TrimSuffix(file.Destination.Registry, "/") + "/" + repo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	p, err := newPusher(d, ref, credentials, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.login(); err != nil {
+		return nil, fmt.Errorf("login %s: %w", ref.Registry, err)
+	}
+
+	return &registryTarget{pusher: p}, nil
+}
+
+// syncTag copy tag unless upstream digest is the one synced last time
+func (d *Dp) syncTag(target syncTarget, platforms []string, tag string) SyncResult {
+	d.image.ref.Tag, d.image.tag = tag, tag
+	result := SyncResult{Source: d.image.ref.String(), Destination: target.name(tag)}
+	fail := func(err error) SyncResult {
+		d.log.Errorf("sync %s: %s", result.Source, err)
+		result.Action, result.Error = SyncFailed, err.Error()
+		return result
+	}
+	// token of repository may expire while previous tags are copied
+	if err := d.renewToken(d.image); err != nil {
+		return fail(err)
+	}
+
+	digest, _, err := d.headManifest(tag)
+	if err != nil {
+		return fail(err)
+	}
+	result.Digest = digest
+	synced, err := target.sourceDigest(tag)
+	if err != nil {
+		return fail(err)
+	}
+	if synced == digest {
+		result.Action = SyncUnchanged
+		return result
+	}
+
+	content, err := d.refreshToken()
+	if err != nil {
+		return fail(err)
+	}
+	if d.image.indexDigest != digest {
+		// tag is moved after HEAD request
+		result.Digest = d.image.indexDigest
+	}
+	mediaType := contentMediaType(d.image.indexMediaType, content)
+
+	if isManifest(content) {
+		if err := d.syncManifest(target, content); err != nil {
+			return fail(err)
+		}
+	} else {
+		content, err = filterIndex(content, result.Digest, platforms)
+		if err != nil {
+			return fail(err)
+		}
+		var index http.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return fail(fmt.Errorf("parse index: %w", err))
+		}
+		for _, desc := range index.Manifests {
+			if err := d.renewToken(d.image); err != nil {
+				return fail(err)
+			}
+			_, manifest, err := d.getDigestSource(desc.Digest)
+			if err != nil {
+				return fail(err)
+			}
+			if err := d.syncManifest(target, manifest); err != nil {
+				return fail(err)
+			}
+			if err := target.pushManifest(desc.Digest, contentMediaType(desc.MediaType, manifest), manifest); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := target.pushManifest(tag, mediaType, content); err != nil {
+		return fail(err)
+	}
+
+	result.Action = SyncCopied
+	if synced != "" {
+		result.Action = SyncUpdated
+	}
+	fmt.Fprintf(d.out, "%s %s\n", result.Action, result.Destination)
+	return result
+}
+
+// syncManifest push config and layers of manifest to target
+func (d *Dp) syncManifest(target syncTarget, content []byte) error {
+	blobs, err := manifestBlobs(content)
+	if err != nil {
+		return err
+	}
+
+	image := d.image
+	for _, blob := range blobs {
+		err := target.pushBlob(blob, func() (io.ReadCloser, error) {
+			return d.openBlob(image, blob.Digest, blob.MediaType)
+		})
+		if err != nil {
+			return fmt.Errorf("push blob %s: %w", blob.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// filterIndex keep manifests of platforms in index, and annotate it with digest of upstream index
+// which is compared in next sync, index is kept byte for byte if all manifests are selected
+func filterIndex(content []byte, digest string, platforms []string) ([]byte, error) {
+	if len(platforms) == 0 {
+		return content, nil
+	}
+
+	var index http.Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+
+	selected := make([]http.Descriptor, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		if desc.Platform == nil {
+			continue
+		}
+		for _, platform := range platforms {
+			if want := parsePlatform(platform); desc.Platform.OS == want.OS && desc.Platform.Architecture == want.Architecture &&
+				(want.Variant == "" || desc.Platform.Variant == want.Variant) {
+				selected = append(selected, desc)
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("don't found platforms: %s", strings.Join(platforms, ","))
+	}
+	if len(selected) == len(index.Manifests) {
+		return content, nil
+	}
+
+	index.Manifests = selected
+	if index.Annotations == nil {
+		index.Annotations = make(map[string]string)
+	}
+	index.Annotations[AnnotationSourceDigest] = digest
+	return json.Marshal(index)
+}
+
+// syncedDigest return digest of upstream index annotated in content, or digest of content
+func syncedDigest(content []byte) string {
+	var probe struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	json.Unmarshal(content, &probe)
+	if digest := probe.Annotations[AnnotationSourceDigest]; digest != "" {
+		return digest
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func (t *registryTarget) sourceDigest(tag string) (string, error) {
+	r, err := t.send(nethttp.MethodGet, t.url(MANIFESTS, tag), http.SetAccept(AcceptRefresh))
+	if err != nil {
+		return "", err
+	}
+	if r.Code() == nethttp.StatusNotFound {
+		return "", nil
+	}
+	if err := checkResponse(r); err != nil {
+		return "", fmt.Errorf("get manifest %s: %w", t.name(tag), err)
+	}
+
+	return syncedDigest(r.Body()), nil
+}
+
+func (t *registryTarget) tags() ([]string, error) {
+	return listTags(t.endpoint, t.ref.Repository, func(url string) (*http.Response, error) {
+		return t.send(nethttp.MethodGet, url)
+	})
+}
+
+// untag delete tag with `DELETE /v2/<name>/manifests/<tag>`, manifest is kept for other tags
+func (t *registryTarget) untag(tag string) error {
+	r, err := t.send(nethttp.MethodDelete, t.url(MANIFESTS, tag))
+	if err != nil {
+		return err
+	}
+	switch r.Code() {
+	case nethttp.StatusAccepted, nethttp.StatusOK:
+		return nil
+	case nethttp.StatusMethodNotAllowed, nethttp.StatusBadRequest:
+		return fmt.Errorf("registry %s doesn't support deleting tag", t.ref.Registry)
+	}
+
+	return checkResponse(r)
+}
+
+func (t *registryTarget) name(tag string) string {
+	if tag == "" {
+		return t.ref.Name()
+	}
+	return t.ref.Name() + ":" + tag
+}
+
+func (t *registryTarget) close() error {
+	return nil
+}
+
+func (t *layoutTarget) sourceDigest(tag string) (string, error) {
+	desc, ok := t.Tags()[tag]
+	if !ok {
+		return "", nil
+	}
+	content, err := t.ReadBlob(desc.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	return syncedDigest(content), nil
+}
+
+func (t *layoutTarget) pushBlob(desc http.Descriptor, open func() (io.ReadCloser, error)) error {
+	return t.WriteBlob(desc, open)
+}
+
+// pushManifest write manifest blob, which is tagged if reference is tag
+func (t *layoutTarget) pushManifest(reference, mediaType string, content []byte) error {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	desc := http.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+	err := t.WriteBlob(desc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reference, "sha256:") {
+		t.Tag(t.repoName+":"+reference, desc)
+	}
+
+	return nil
+}
+
+func (t *layoutTarget) tags() ([]string, error) {
+	var tags []string
+	for tag := range t.Tags() {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (t *layoutTarget) untag(tag string) error {
+	t.Untag(tag)
+	return nil
+}
+
+func (t *layoutTarget) name(tag string) string {
+	if tag == "" {
+		return t.dir
+	}
+	return t.dir + ":" + tag
+}
+
+// close save index.json of layout
+func (t *layoutTarget) close() error {
+	return t.Save()
+}
+
+// manifestBlobs return config and layers of manifest
+func manifestBlobs(content []byte) ([]http.Descriptor, error) {
+	manifest, err := parseManifest(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]http.Descriptor{manifest.Config}, manifest.Layers...), nil
+}
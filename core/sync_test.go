@@ -0,0 +1,197 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anoyah/downer/archive"
+	"github.com/anoyah/downer/http"
+)
+
+func writeSyncFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sync.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runSync(t *testing.T, file string) *SyncReport {
+	t.Helper()
+
+	report, err := Sync(&SyncConfig{Config: Config{CacheDir: t.TempDir()}, File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestSyncRegistry(t *testing.T) {
+	source := newTestRegistry(t)
+	source.pageSize = 2
+	image := seedRegistry(t, source, "library/nginx", "1.25.1")
+	for _, tag := range []string{"1.25.2", "1.26.0", "latest", "mainline"} {
+		source.tag("library/nginx", tag, image.index, "application/vnd.oci.image.index.v1+json")
+	}
+	registry := newTestRegistry(t)
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+
+	file := writeSyncFile(t, fmt.Sprintf(`
+destination:
+  registry: %s/mirror
+insecure: [%s, %s]
+prune: true
+report: %s
+repositories:
+  - source: %s/library/nginx
+    name: nginx
+    tags: [latest]
+    semver: "~1.25"
+`, registry.host(), source.host(), registry.host(), reportPath, source.host()))
+
+	report := runSync(t, file)
+	if report.Copied != 3 || report.Failed != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, tag := range []string{"1.25.1", "1.25.2", "latest"} {
+		if got := registry.tags["mirror/nginx:"+tag]; got != image.index {
+			t.Fatalf("%s points to %s, want %s", tag, got, image.index)
+		}
+	}
+	if _, ok := registry.tags["mirror/nginx:1.26.0"]; ok {
+		t.Fatal("tag out of range is synced")
+	}
+
+	// unchanged tags are skipped
+	if report := runSync(t, file); report.Unchanged != 3 || report.Copied != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// moved tag is updated and vanished tag is pruned
+	moved := buildTestImage(t, "moved", func(content []byte) string {
+		return source.put("library/nginx", content)
+	})
+	source.tag("library/nginx", "1.25.2", moved.index, "application/vnd.oci.image.index.v1+json")
+	delete(source.tags, "library/nginx:1.25.1")
+	registry.tag("mirror/nginx", "custom", image.index, "application/vnd.oci.image.index.v1+json")
+
+	report = runSync(t, file)
+	if report.Copied != 1 || report.Unchanged != 1 || report.Pruned != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if got := registry.tags["mirror/nginx:1.25.2"]; got != moved.index {
+		t.Fatalf("1.25.2 points to %s, want %s", got, moved.index)
+	}
+	if _, ok := registry.tags["mirror/nginx:1.25.1"]; ok {
+		t.Fatal("vanished tag isn't pruned")
+	}
+	if _, ok := registry.tags["mirror/nginx:custom"]; !ok {
+		t.Fatal("tag which doesn't match filters is pruned")
+	}
+
+	var saved SyncReport
+	content, _ := os.ReadFile(reportPath)
+	if err := json.Unmarshal(content, &saved); err != nil || saved.Pruned != 1 || len(saved.Results) != 3 {
+		t.Fatalf("unexpected saved report: %s", content)
+	}
+}
+
+func TestSyncDirectory(t *testing.T) {
+	source := newTestRegistry(t)
+	image := seedRegistry(t, source, "library/redis", "7.2.4")
+	source.tag("library/redis", "7.4.0", image.index, "application/vnd.oci.image.index.v1+json")
+	dir := t.TempDir()
+
+	file := writeSyncFile(t, fmt.Sprintf(`
+destination:
+  directory: %s
+insecure: [%s]
+platforms: [linux/amd64]
+repositories:
+  - source: %s/library/redis
+    regex: '^7\.2\.'
+`, dir, source.host(), source.host()))
+
+	if report := runSync(t, file); report.Copied != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report := runSync(t, file); report.Unchanged != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	layout, err := archive.OpenSource(filepath.Join(dir, "library", "redis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer layout.Close()
+	if len(layout.Images) != 1 || layout.Images[0].RepoTags[0] != source.host()+"/library/redis:7.2.4" {
+		t.Fatalf("unexpected images: %+v", layout.Images)
+	}
+}
+
+func TestFilterIndex(t *testing.T) {
+	index, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests": []http.Descriptor{
+			{Digest: "sha256:amd64", Platform: &http.Platform{OS: "linux", Architecture: "amd64"}},
+			{Digest: "sha256:arm64", Platform: &http.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+			{Digest: "sha256:attestation", Platform: &http.Platform{OS: "unknown", Architecture: "unknown"}},
+		},
+	})
+
+	filtered, err := filterIndex(index, "sha256:upstream", []string{"linux/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		MediaType   string            `json:"mediaType"`
+		Manifests   []http.Descriptor `json:"manifests"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	json.Unmarshal(filtered, &got)
+	if len(got.Manifests) != 1 || got.Manifests[0].Digest != "sha256:arm64" || got.MediaType == "" {
+		t.Fatalf("unexpected index: %s", filtered)
+	}
+	if syncedDigest(filtered) != "sha256:upstream" {
+		t.Fatalf("upstream digest isn't annotated: %s", filtered)
+	}
+
+	if _, err := filterIndex(index, "sha256:upstream", []string{"linux/s390x"}); err == nil {
+		t.Fatal("expected error of missing platform")
+	}
+}
+
+func TestSyncRenewToken(t *testing.T) {
+	// tokens expire after a few requests, so one token can't sync all tags
+	source := newTestRegistry(t)
+	source.auth, source.expireAfter = true, 3
+	image := seedRegistry(t, source, "library/nginx", "1")
+	for _, tag := range []string{"2", "3"} {
+		source.tag("library/nginx", tag, image.index, "application/vnd.oci.image.index.v1+json")
+	}
+	registry := newTestRegistry(t)
+	registry.auth, registry.expireAfter = true, 3
+
+	file := writeSyncFile(t, fmt.Sprintf(`
+destination:
+  registry: %s/mirror
+insecure: [%s, %s]
+repositories:
+  - source: %s/library/nginx
+    name: nginx
+`, registry.host(), source.host(), registry.host(), source.host()))
+
+	report := runSync(t, file)
+	if report.Copied != 3 || report.Failed != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if source.rejected != 0 || registry.rejected != 0 {
+		t.Fatalf("expired tokens are used: %d of source, %d of destination", source.rejected, registry.rejected)
+	}
+}
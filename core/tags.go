@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/anoyah/downer/http"
+	"github.com/anoyah/downer/tools"
+)
+
+const tagsUrl = "%s/v2/%s/tags/list"
+
+// listTags list tags of repository with `/v2/<name>/tags/list`, following pages of `Link` header
+func listTags(endpoint, repository string, get func(url string) (*http.Response, error)) ([]string, error) {
+	var (
+		tags []string
+		next = fmt.Sprintf(tagsUrl, endpoint, repository)
+		seen = make(map[string]struct{})
+	)
+	for next != "" {
+		if _, ok := seen[next]; ok {
+			return nil, fmt.Errorf("list tags of %s: page %s is repeated", repository, next)
+		}
+		seen[next] = struct{}{}
+
+		r, err := get(next)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkResponse(r); err != nil {
+			return nil, fmt.Errorf("list tags of %s: %w", repository, err)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(r.Body(), &page); err != nil {
+			return nil, fmt.Errorf("parse tags of %s: %w", repository, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		if next, err = nextPage(next, r.Header.Get("Link")); err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// nextPage return url of `rel="next"` in Link header such as `</v2/nginx/tags/list?last=1.25&n=100>; rel="next"`,
+// which is resolved against current url
+func nextPage(current, link string) (string, error) {
+	for _, item := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(item, ";")
+		if !ok {
+			continue
+		}
+		var isNext bool
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "rel" && strings.Contains(" "+strings.Trim(value, `"`)+" ", " next ") {
+				isNext = true
+			}
+		}
+		if !isNext {
+			continue
+		}
+
+		base, err := url.Parse(current)
+		if err != nil {
+			return "", err
+		}
+		u, err := base.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return "", fmt.Errorf("invalid link %q: %w", link, err)
+		}
+		return u.String(), nil
+	}
+
+	return "", nil
+}
+
+// listTags list tags of repository of current image
+func (d *Dp) listTags() ([]string, error) {
+	return listTags(d.registryEndpoint(), d.image.ref.Repository, func(url string) (*http.Response, error) {
+		d.log.Debugf("list tags with url: %s", url)
+		return d.client.Do(context.Background(), url, d.image.authorization())
+	})
+}
+
+// TagsConfig config of listing tags of repository
+type TagsConfig struct {
+	// Config repository is Name, such as `nginx`, `ghcr.io/org/app`
+	Config
+	// Regex keep tags matching it
+	Regex string
+	// SortSemver sort tags by version, tags which aren't versions follow by name
+	SortSemver bool
+	// LatestMatching return the greatest version in range only, such as `~1.25`
+	LatestMatching string
+}
+
+// Tags list tags of repository in order of registry, which are filtered and sorted by config
+func Tags(cfg *TagsConfig) ([]string, error) {
+	ref, err := tools.ParseReference(cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	var regex *regexp.Regexp
+	if cfg.Regex != "" {
+		if regex, err = regexp.Compile(cfg.Regex); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	var constraint *tools.Constraint
+	if cfg.LatestMatching != "" {
+		if constraint, err = tools.ParseConstraint(cfg.LatestMatching); err != nil {
+			return nil, err
+		}
+	}
+
+	d, err := newRemote(&cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.use(ref); err != nil {
+		return nil, err
+	}
+	tags, err := d.listTags()
+	if err != nil {
+		return nil, err
+	}
+
+	if regex != nil {
+		tags = slices.DeleteFunc(tags, func(tag string) bool { return !regex.MatchString(tag) })
+	}
+	if constraint != nil {
+		latest := constraint.LatestMatching(tags)
+		if latest == "" {
+			return nil, fmt.Errorf("no tag of %s matches %s", ref.Name(), cfg.LatestMatching)
+		}
+		return []string{latest}, nil
+	}
+	if cfg.SortSemver {
+		tools.SortTags(tags)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.auth = true
+	registry.pageSize = 2
+	image := seedRegistry(t, registry, "library/nginx", "latest")
+	for _, tag := range []string{"1.25.10", "1.25.9", "1.26.0-rc.1", "1.24.0", "alpine"} {
+		registry.tag("library/nginx", tag, image.index, "application/vnd.oci.image.index.v1+json")
+	}
+
+	list := func(cfg TagsConfig) []string {
+		t.Helper()
+		cfg.Name = registry.host() + "/library/nginx"
+		cfg.NoCache = true
+		cfg.Insecure = []string{registry.host()}
+		tags, err := Tags(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tags
+	}
+
+	// all pages are listed
+	if tags := list(TagsConfig{}); len(tags) != 6 {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	if tags := list(TagsConfig{Regex: `^1\.`, SortSemver: true}); !slices.Equal(tags, []string{"1.24.0", "1.25.9", "1.25.10", "1.26.0-rc.1"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	if tags := list(TagsConfig{LatestMatching: "~1.25"}); !slices.Equal(tags, []string{"1.25.10"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	_, err := Tags(&TagsConfig{
+		Config:         Config{Name: registry.host() + "/library/nginx", NoCache: true, Insecure: []string{registry.host()}},
+		LatestMatching: "^2",
+	})
+	if err == nil {
+		t.Fatal("expected error when no tag matches")
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	cases := map[string]string{
+		`</v2/nginx/tags/list?last=b&n=2>; rel="next"`:                                       "https://r.io/v2/nginx/tags/list?last=b&n=2",
+		`<https://cdn.r.io/v2/nginx/tags/list?last=b>; rel=next`:                             "https://cdn.r.io/v2/nginx/tags/list?last=b",
+		`</v2/nginx/tags/list?last=a>; rel="prev", </v2/nginx/tags/list?last=c>; rel="next"`: "https://r.io/v2/nginx/tags/list?last=c",
+		``: "",
+	}
+	for link, want := range cases {
+		got, err := nextPage("https://r.io/v2/nginx/tags/list", link)
+		if err != nil || got != want {
+			t.Errorf("next page of %q: got %q, %v, want %q", link, got, err, want)
+		}
+	}
+}
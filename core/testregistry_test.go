@@ -0,0 +1,331 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry in-process registry with distribution API, content is kept in memory
+type testRegistry struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// blobs content of blobs and manifests by digest
+	blobs map[string][]byte
+	// repos digests of blobs and manifests in every repository
+	repos      map[string]map[string]struct{}
+	tags       map[string]string
+	mediaTypes map[string]string
+	uploads    map[string][]byte
+
+	// auth require bearer token from `/token`, token is scopes joined with space and its number
+	auth bool
+	// tokens number of issued tokens, tokens numbered below valid are rejected as expired
+	tokens int
+	valid  int
+	// expireAfter tokens are rejected after they are used so many times, and reported to expire in a second
+	expireAfter int
+	uses        map[int]int
+	// basic require basic authentication with `user:password` instead of token
+	basic string
+	// refuseMount start upload session instead of mounting blob
+	refuseMount bool
+	// pageSize tags in one page of tags list, all tags are listed if it's 0
+	pageSize int
+	// hideDigest don't report Docker-Content-Digest of content
+	hideDigest bool
+
+	// counters of requests
+	monolithic int
+	rejected   int
+	patches    int
+	manifests  int
+	mounts     int
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+
+	r := &testRegistry{
+		blobs:      make(map[string][]byte),
+		repos:      make(map[string]map[string]struct{}),
+		tags:       make(map[string]string),
+		mediaTypes: make(map[string]string),
+		uploads:    make(map[string][]byte),
+		uses:       make(map[int]int),
+	}
+	r.Server = httptest.NewServer(r)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host return host of registry, which is insecure registry of reference
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// put add content to repository and return its digest
+func (r *testRegistry) put(repo string, content []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.putLocked(repo, content)
+}
+
+func (r *testRegistry) putLocked(repo string, content []byte) string {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	r.blobs[digest] = content
+	if r.repos[repo] == nil {
+		r.repos[repo] = make(map[string]struct{})
+	}
+	r.repos[repo][digest] = struct{}{}
+	return digest
+}
+
+// tag point tag of repository to manifest
+func (r *testRegistry) tag(repo, tag, digest, mediaType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tags[repo+":"+tag] = digest
+	r.mediaTypes[digest] = mediaType
+}
+
+// has check whether content is in repository
+func (r *testRegistry) has(repo, digest string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.repos[repo][digest]
+	return ok
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		r.tokens++
+		token := map[string]any{"token": fmt.Sprintf("%s #%d", strings.Join(req.URL.Query()["scope"], " "), r.tokens)}
+		if r.expireAfter > 0 {
+			token["expires_in"] = 1
+		}
+		content, _ := json.Marshal(token)
+		w.Write(content)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if username, password, ok := req.BasicAuth(); r.basic != "" && (!ok || username+":"+password != r.basic) {
+		w.Header().Set(WwwAuthenticate, `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.auth && !r.authorized(req) {
+		// realm follows other parameters, which are in any order
+		challenge := `Bearer service="test"`
+		if index := strings.Index(path, "/manifests/"); index > 0 {
+			challenge += fmt.Sprintf(`,scope="repository:%s:pull"`, path[:index])
+		}
+		challenge += fmt.Sprintf(`,realm="%s/token"`, r.URL)
+		w.Header().Set(WwwAuthenticate, challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repo, id)
+	case strings.Contains(path, "/blobs/"):
+		repo, digest, _ := strings.Cut(path, "/blobs/")
+		r.serveContent(w, req, repo, digest, "application/octet-stream")
+	case strings.Contains(path, "/manifests/"):
+		repo, reference, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repo, reference)
+	case strings.HasSuffix(path, "/tags/list"):
+		r.serveTags(w, req, strings.TrimSuffix(path, "/tags/list"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// authorized check whether request has bearer token which isn't expired
+func (r *testRegistry) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	_, number, _ := strings.Cut(token, "#")
+	n, _ := strconv.Atoi(number)
+	if n < r.valid || (r.expireAfter > 0 && r.uses[n] >= r.expireAfter) {
+		r.rejected++
+		return false
+	}
+	r.uses[n]++
+
+	return true
+}
+
+// expireTokens reject tokens issued so far
+func (r *testRegistry) expireTokens() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.valid = r.tokens + 1
+}
+
+func (r *testRegistry) serveContent(w http.ResponseWriter, req *http.Request, repo, digest, mediaType string) {
+	if _, ok := r.repos[repo][digest]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	content := r.blobs[digest]
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	if !r.hideDigest {
+		w.Header().Set(DockerContentDigest, digest)
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		w.Write(content)
+	}
+}
+
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo, reference string) {
+	if req.Method == http.MethodPut {
+		content, _ := io.ReadAll(req.Body)
+		digest := r.putLocked(repo, content)
+		r.mediaTypes[digest] = req.Header.Get("Content-Type")
+		if !strings.HasPrefix(reference, "sha256:") {
+			r.tags[repo+":"+reference] = digest
+		} else if reference != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.manifests++
+		w.Header().Set(DockerContentDigest, digest)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if req.Method == http.MethodDelete {
+		if _, ok := r.tags[repo+":"+reference]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(r.tags, repo+":"+reference)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repo+":"+reference]
+	}
+	r.serveContent(w, req, repo, digest, r.mediaTypes[digest])
+}
+
+// serveTags list sorted tags after `last` with pages of pageSize
+func (r *testRegistry) serveTags(w http.ResponseWriter, req *http.Request, repo string) {
+	var tags []string
+	for key := range r.tags {
+		if name, tag, _ := strings.Cut(key, ":"); name == repo && tag > req.URL.Query().Get("last") {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	if r.pageSize > 0 && len(tags) > r.pageSize {
+		tags = tags[:r.pageSize]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%s&n=%d>; rel="next"`, repo, tags[len(tags)-1], r.pageSize))
+	}
+
+	content, _ := json.Marshal(map[string]any{"name": repo, "tags": tags})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
+
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	switch req.Method {
+	case http.MethodPost:
+		if digest, from := req.URL.Query().Get("mount"), req.URL.Query().Get("from"); digest != "" && r.canMount(req, digest, from) {
+			r.putLocked(repo, r.blobs[digest])
+			r.mounts++
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+			w.Header().Set(DockerContentDigest, digest)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		id = strconv.Itoa(len(r.uploads) + 1)
+		r.uploads[id] = []byte{}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	content, ok := r.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+
+	switch req.Method {
+	case http.MethodPatch:
+		if contentRange := fmt.Sprintf("%d-%d", len(content), len(content)+len(body)-1); req.Header.Get("Content-Range") != contentRange {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		r.uploads[id] = append(content, body...)
+		r.patches++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(r.uploads[id])-1))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		if len(body) > 0 {
+			if req.ContentLength != int64(len(body)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.monolithic++
+		}
+		content = append(content, body...)
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		if digest != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(r.uploads, id)
+		r.putLocked(repo, content)
+		w.Header().Set(DockerContentDigest, digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// canMount check whether blob is in repository from, and token is allowed to pull from it
+func (r *testRegistry) canMount(req *http.Request, digest, from string) bool {
+	if r.refuseMount {
+		return false
+	}
+	if _, ok := r.repos[from][digest]; !ok {
+		return false
+	}
+	if !r.auth {
+		return true
+	}
+
+	scopes := strings.Fields(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+	return slices.Contains(scopes, "repository:"+from+":pull")
+}
@@ -2,19 +2,55 @@ package main
 
 import (
 	"flag"
+	"os"
+	"strings"
 
 	"github.com/anoyah/downer/core"
 )
 
 var (
 	archFlag    = flag.String("arch", "linux/amd64", "--arch linux/amd64")
-	imageFlag   = flag.String("image", "", "--image nginx:alpine")
 	proxyFlag   = flag.String("proxy", "", "--proxy http://127.0.0.1.7890")
 	verboseFlag = flag.Bool("verbose", false, "--verbose")
 	outputFlag  = flag.String("output", "", "--output ./images/xx.tar.gz")
+
+	waitRateLimitFlag = flag.Bool("wait-ratelimit", false, "--wait-ratelimit")
+	limitRateFlag     = flag.String("limit-rate", "", "--limit-rate 5M")
+	limitScheduleFlag = flag.String("limit-schedule", "", "--limit-schedule 08:00-18:00=5M,18:00-08:00=off")
+	cacheDirFlag      = flag.String("cache-dir", "", "--cache-dir ~/.cache/downer")
+	noCacheFlag       = flag.Bool("no-cache", false, "--no-cache")
+	cacheMaxSizeFlag  = flag.String("cache-max-size", "", "--cache-max-size 50G")
+	offlineFlag       = flag.Bool("offline", false, "--offline")
+	formatFlag        = flag.String("format", "docker", "--format docker|oci|oci-archive")
+	compressionFlag   = flag.String("compression", "", "--compression none|gzip|zstd, default is gzip for docker and none for oci-archive")
+	levelFlag         = flag.Int("compression-level", 0, "--compression-level 1-9 for gzip, 1-22 for zstd")
+	splitSizeFlag     = flag.String("split-size", "", "--split-size 2G")
+	loadFlag          = flag.Bool("load", false, "--load streams archive to docker daemon instead of writing file")
+	dockerHostFlag    = flag.String("docker-host", "", "--docker-host unix:///var/run/docker.sock, default is DOCKER_HOST")
+	dryRunFlag        = flag.Bool("dry-run", false, "--dry-run, print blobs to fetch and disk space needed without downloading layers")
+
+	imageListFlag = flag.String("image-list", "", "--image-list ./images.txt")
+
+	imageFlags stringsFlag
+	tagFlags   stringsFlag
 )
 
+func init() {
+	flag.Var(&imageFlags, "image", "--image nginx:alpine, can be repeated to write several images to one archive")
+	flag.Var(&tagFlags, "tag", "--tag registry.local/nginx:alpine, can be repeated")
+	flag.StringVar(outputFlag, "o", "", "-o ./images/xx.tar.gz, shorthand of --output, `-` streams archive to stdout")
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
 	var debug bool
@@ -22,12 +58,38 @@ func main() {
 		debug = true
 	}
 
+	images := imageFlags
+	if *imageListFlag != "" {
+		list, err := readImageList(*imageListFlag)
+		if err != nil {
+			panic(err)
+		}
+		images = append(images, list...)
+	}
+
 	d, err := core.NewDp(&core.Config{
 		Arch:   *archFlag,
-		Name:   *imageFlag,
+		Images: images,
 		Proxy:  *proxyFlag,
 		Debug:  debug,
 		Output: *outputFlag,
+
+		WaitRateLimit: *waitRateLimitFlag,
+		LimitRate:     *limitRateFlag,
+		LimitSchedule: *limitScheduleFlag,
+		CacheDir:      *cacheDirFlag,
+		NoCache:       *noCacheFlag,
+		CacheMaxSize:  *cacheMaxSizeFlag,
+		Offline:       *offlineFlag,
+		Format:        *formatFlag,
+
+		Compression:      *compressionFlag,
+		CompressionLevel: *levelFlag,
+		SplitSize:        *splitSizeFlag,
+		Tags:             tagFlags,
+		Load:             *loadFlag,
+		DockerHost:       *dockerHostFlag,
+		DryRun:           *dryRunFlag,
 	})
 	if err != nil {
 		panic(err)
@@ -37,3 +99,22 @@ func main() {
 		panic(err)
 	}
 }
+
+// readImageList read images from file, one per line, empty lines and lines starting with `#` are ignored
+func readImageList(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		images = append(images, line)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultHost socket of Docker daemon when DOCKER_HOST isn't set
+	DefaultHost = "unix:///var/run/docker.sock"
+
+	EnvHost      = "DOCKER_HOST"
+	EnvTLSVerify = "DOCKER_TLS_VERIFY"
+	EnvCertPath  = "DOCKER_CERT_PATH"
+)
+
+type (
+	// Client client of Docker Engine API
+	Client struct {
+		http *http.Client
+		// base url of API, host is meaningless for unix socket
+		base string
+	}
+
+	// Message item of JSON progress stream of daemon
+	Message struct {
+		Stream      string `json:"stream,omitempty"`
+		Status      string `json:"status,omitempty"`
+		ID          string `json:"id,omitempty"`
+		Progress    string `json:"progress,omitempty"`
+		Error       string `json:"error,omitempty"`
+		ErrorDetail *struct {
+			Message string `json:"message"`
+		} `json:"errorDetail,omitempty"`
+	}
+)
+
+// NewClient create client of daemon at host such as `unix:///var/run/docker.sock` or
+// `tcp://host:2376`, DOCKER_HOST or DefaultHost is used if host is empty. TLS of tcp is
+// configured by DOCKER_TLS_VERIFY and DOCKER_CERT_PATH the same as docker cli.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv(EnvHost)
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	client := &Client{http: &http.Client{Transport: transport}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		client.base = "http://docker"
+	case "tcp", "http", "https":
+		scheme := "http"
+		tlsConfig, err := tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil || u.Scheme == "https" {
+			scheme = "https"
+			transport.TLSClientConfig = tlsConfig
+		}
+		client.base = scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")
+	default:
+		return nil, fmt.Errorf("unsupported docker host: %s", host)
+	}
+
+	return client, nil
+}
+
+// tlsConfig return nil if neither DOCKER_TLS_VERIFY nor DOCKER_CERT_PATH is set
+func tlsConfig() (*tls.Config, error) {
+	verify := os.Getenv(EnvTLSVerify) != ""
+	certPath := os.Getenv(EnvCertPath)
+	if !verify && certPath == "" {
+		return nil, nil
+	}
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		certPath = filepath.Join(home, ".docker")
+	}
+
+	config := &tls.Config{InsecureSkipVerify: !verify}
+	if ca, err := os.ReadFile(filepath.Join(certPath, "ca.pem")); err == nil {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid ca.pem in %s", certPath)
+		}
+	} else if verify {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err == nil {
+		config.Certificates = []tls.Certificate{cert}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Load stream archive of `docker save` or OCI archive to `POST /images/load`, archive may be
+// compressed. Progress reported by daemon is written to progress.
+func (c *Client) Load(ctx context.Context, archive io.Reader, progress io.Writer) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/images/load?quiet=0", archive)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-tar")
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return fmt.Errorf("load images to docker: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		var message struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &message) == nil && message.Message != "" {
+			body = []byte(message.Message)
+		}
+		return fmt.Errorf("load images to docker: unexpected status code %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return DisplayMessages(response.Body, progress)
+}
+
+// DisplayMessages print JSON progress stream, repeated status of the same id is printed once,
+// error in stream is returned
+func DisplayMessages(r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(r)
+	statuses := make(map[string]string)
+	for {
+		var message Message
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read progress of docker: %w", err)
+		}
+
+		switch {
+		case message.ErrorDetail != nil && message.ErrorDetail.Message != "":
+			return errors.New(message.ErrorDetail.Message)
+		case message.Error != "":
+			return errors.New(message.Error)
+		case message.Stream != "":
+			fmt.Fprint(w, message.Stream)
+		case message.Status != "":
+			if statuses[message.ID] == message.Status {
+				continue
+			}
+			statuses[message.ID] = message.Status
+			if message.ID != "" {
+				fmt.Fprintf(w, "%s: %s\n", message.ID, message.Status)
+			} else {
+				fmt.Fprintln(w, message.Status)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDaemon serve Engine API on unix socket, archive loaded is passed to load which returns messages
+func fakeDaemon(t *testing.T, load func(body []byte) []Message) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/images/load" {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"message": "page not found"})
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			for _, message := range load(body) {
+				encoder.Encode(message)
+			}
+		})},
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return "unix://" + socket
+}
+
+func testArchive() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := []byte(`[{"Config":"config.json","RepoTags":["nginx:alpine"],"Layers":[]}]`)
+	tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestLoad(t *testing.T) {
+	host := fakeDaemon(t, func(body []byte) []Message {
+		header, err := tar.NewReader(bytes.NewReader(body)).Next()
+		if err != nil || header.Name != "manifest.json" {
+			return []Message{{Error: "invalid archive"}}
+		}
+		return []Message{
+			{Status: "Loading layer", ID: "abc", Progress: "[=>  ]"},
+			{Status: "Loading layer", ID: "abc", Progress: "[===>]"},
+			{Stream: "Loaded image: nginx:alpine\n"},
+		}
+	})
+
+	client, err := NewClient(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress bytes.Buffer
+	if err := client.Load(context.Background(), bytes.NewReader(testArchive()), &progress); err != nil {
+		t.Fatal(err)
+	}
+	if want := "abc: Loading layer\nLoaded image: nginx:alpine\n"; progress.String() != want {
+		t.Fatalf("unexpected progress: %q", progress.String())
+	}
+
+	// error in progress stream is returned
+	err = client.Load(context.Background(), strings.NewReader("not a tar"), io.Discard)
+	if err == nil || err.Error() != "invalid archive" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Setenv(EnvHost, "tcp://127.0.0.1:2375")
+	t.Setenv(EnvTLSVerify, "")
+	t.Setenv(EnvCertPath, "")
+
+	client, err := NewClient("")
+	if err != nil || client.base != "http://127.0.0.1:2375" {
+		t.Fatalf("unexpected client: %+v, %v", client, err)
+	}
+
+	// tls is required by DOCKER_TLS_VERIFY, ca.pem is missing
+	t.Setenv(EnvTLSVerify, "1")
+	t.Setenv(EnvCertPath, t.TempDir())
+	if _, err := NewClient(""); err == nil {
+		t.Fatal("expect error without ca.pem")
+	}
+
+	if _, err := NewClient("ssh://host"); err == nil {
+		t.Fatal("expect error of unsupported host")
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "strings"
+
+// stringsFlag repeatable flag, such as `--tag a --tag b`
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -4,7 +4,10 @@ go 1.23.4
 
 require (
 	github.com/go-resty/resty/v2 v2.16.2
+	github.com/klauspost/compress v1.18.0
+	github.com/klauspost/pgzip v1.2.6
 	go.uber.org/zap v1.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Challenge parsed `Www-Authenticate` header, such as
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`
+type Challenge struct {
+	// Scheme `Bearer` or `Basic`
+	Scheme string
+	Params map[string]string
+}
+
+// ParseChallenge parse challenge of registry, nil is returned if header is empty
+func ParseChallenge(header string) *Challenge {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+
+	scheme, rest, _ := strings.Cut(header, " ")
+	challenge := &Challenge{Scheme: scheme, Params: make(map[string]string)}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		// value is quoted string which may contain comma, such as scope `repository:a:pull,push`
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				challenge.Params[key] = value[1:]
+				break
+			}
+			challenge.Params[key] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			challenge.Params[key] = strings.TrimSpace(value)
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+		rest = strings.TrimSpace(rest)
+	}
+
+	return challenge
+}
+
+// IsBearer check whether registry requires token from realm
+func (c *Challenge) IsBearer() bool {
+	return strings.EqualFold(c.Scheme, "Bearer")
+}
+
+// TokenUrl return url to request token of scopes from realm
+func (c *Challenge) TokenUrl(scopes ...string) string {
+	query := url.Values{}
+	if service := c.Params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+
+	realm := c.Params["realm"]
+	if len(query) == 0 {
+		return realm
+	}
+	if strings.Contains(realm, "?") {
+		return realm + "&" + query.Encode()
+	}
+	return realm + "?" + query.Encode()
+}
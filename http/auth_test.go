@@ -0,0 +1,25 @@
+package http
+
+import "testing"
+
+func TestParseChallenge(t *testing.T) {
+	challenge := ParseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`)
+	if !challenge.IsBearer() {
+		t.Fatalf("unexpected scheme: %s", challenge.Scheme)
+	}
+	if challenge.Params["scope"] != "repository:library/nginx:pull,push" || challenge.Params["service"] != "registry.docker.io" {
+		t.Fatalf("unexpected params: %v", challenge.Params)
+	}
+
+	want := "https://auth.docker.io/token?scope=repository%3Aa%3Apull%2Cpush&scope=repository%3Ab%3Apull&service=registry.docker.io"
+	if got := challenge.TokenUrl("repository:a:pull,push", "repository:b:pull"); got != want {
+		t.Fatalf("unexpected token url: %s", got)
+	}
+
+	if challenge := ParseChallenge(`Basic realm="Registry Realm"`); challenge.IsBearer() || challenge.Params["realm"] != "Registry Realm" {
+		t.Fatalf("unexpected challenge: %+v", challenge)
+	}
+	if ParseChallenge("") != nil {
+		t.Fatal("expected no challenge")
+	}
+}
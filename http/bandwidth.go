@@ -0,0 +1,184 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anoyah/downer/tools"
+)
+
+const minutesOfDay = 24 * 60
+
+type (
+	// Limiter token bucket shared by all blob transfers of client, rate is bytes per second
+	Limiter struct {
+		mu       sync.Mutex
+		rate     int64
+		schedule []ScheduleRule
+		tokens   float64
+		last     time.Time
+
+		now   func() time.Time
+		sleep func(time.Duration)
+	}
+
+	// ScheduleRule use Rate between Start and End, which are minutes of local day.
+	// Rule wraps midnight when Start is greater than End, Rate 0 means unlimited.
+	ScheduleRule struct {
+		Start int
+		End   int
+		Rate  int64
+	}
+)
+
+// NewLimiter create limiter with default rate and optional schedule, rate 0 means unlimited
+func NewLimiter(rate int64, schedule ...ScheduleRule) *Limiter {
+	return &Limiter{
+		rate:     rate,
+		schedule: schedule,
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// ParseSchedule parse schedule like `08:00-18:00=5M,18:00-08:00=off`
+func ParseSchedule(s string) ([]ScheduleRule, error) {
+	var rules []ScheduleRule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		period, rateValue, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule rule: %q", item)
+		}
+		startValue, endValue, ok := strings.Cut(period, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule period: %q", period)
+		}
+
+		var (
+			rule ScheduleRule
+			err  error
+		)
+		if rule.Start, err = parseClock(startValue); err != nil {
+			return nil, err
+		}
+		if rule.End, err = parseClock(endValue); err != nil {
+			return nil, err
+		}
+		if rule.Rate, err = ParseRate(rateValue); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// ParseRate parse rate like `5M`, `off` and `0` mean unlimited
+func ParseRate(s string) (int64, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "off", "unlimited":
+		return 0, nil
+	}
+
+	return tools.ParseSize(s)
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock %q, should be HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (r ScheduleRule) match(minute int) bool {
+	if r.Start <= r.End {
+		return minute >= r.Start && minute < r.End
+	}
+
+	return minute >= r.Start || minute < r.End
+}
+
+// Rate return bytes per second at t, 0 means unlimited
+func (l *Limiter) Rate(t time.Time) int64 {
+	minute := (t.Hour()*60 + t.Minute()) % minutesOfDay
+	for _, rule := range l.schedule {
+		if rule.match(minute) {
+			return rule.Rate
+		}
+	}
+
+	return l.rate
+}
+
+// WaitN take n tokens from bucket, block until the debt is paid back.
+// Bucket holds at most one second of tokens.
+func (l *Limiter) WaitN(n int) {
+	l.mu.Lock()
+	now := l.now()
+	rate := l.Rate(now)
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		l.mu.Unlock()
+		return
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	}
+	if l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// Reader wrap reader to limit its speed
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReader{reader: r, limiter: l}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *Limiter
+}
+
+// limitedChunk read with small chunk so workers share the bucket fairly
+const limitedChunk = 32 << 10
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedChunk {
+		p = p[:limitedChunk]
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.limiter.WaitN(n)
+	}
+
+	return n, err
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimiterReader(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	var slept time.Duration
+
+	limiter := NewLimiter(64 << 10)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	// two readers share the same bucket
+	for range 2 {
+		n, err := io.Copy(io.Discard, limiter.Reader(bytes.NewReader(make([]byte, 128<<10))))
+		if err != nil || n != 128<<10 {
+			t.Fatalf("copy: %d, %v", n, err)
+		}
+	}
+
+	if slept < 3*time.Second || slept > 5*time.Second {
+		t.Fatalf("unexpected sleep: %s", slept)
+	}
+}
+
+func TestLimiterSchedule(t *testing.T) {
+	rules, err := ParseSchedule("08:00-18:00=5M,18:00-08:00=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewLimiter(1<<20, rules...)
+
+	day := time.Date(2024, 1, 1, 9, 30, 0, 0, time.Local)
+	night := time.Date(2024, 1, 1, 2, 0, 0, 0, time.Local)
+	if rate := limiter.Rate(day); rate != 5<<20 {
+		t.Fatalf("unexpected day rate: %d", rate)
+	}
+	if rate := limiter.Rate(night); rate != 0 {
+		t.Fatalf("unexpected night rate: %d", rate)
+	}
+
+	if _, err := ParseSchedule("08:00=5M"); err == nil {
+		t.Fatal("expected error")
+	}
+}
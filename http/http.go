@@ -2,6 +2,8 @@ package http
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -11,12 +13,14 @@ import (
 
 type (
 	Client struct {
-		http  *resty.Client
-		proxy bool
+		http    *resty.Client
+		proxy   bool
+		limiter *Limiter
 	}
 
 	Config struct {
-		proxy string
+		proxy   string
+		limiter *Limiter
 	}
 	ClientOption func(*Config)
 )
@@ -28,6 +32,13 @@ func WithProxy(proxy string) ClientOption {
 	}
 }
 
+// WithLimiter limit bandwidth of all blob transfers sent by client
+func WithLimiter(limiter *Limiter) ClientOption {
+	return func(c *Config) {
+		c.limiter = limiter
+	}
+}
+
 // NewClient create request struct with resty third
 func NewClient(opts ...ClientOption) (*Client, error) {
 	var cfg Config
@@ -37,7 +48,8 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 
 	request := resty.New()
 	client := &Client{
-		http: request,
+		http:    request,
+		limiter: cfg.limiter,
 	}
 
 	if cfg.proxy != "" {
@@ -61,20 +73,60 @@ func (c *Client) SetProxy(proxy string) error {
 }
 
 func (c *Client) Do(ctx context.Context, url string, opts ...HeaderOption) (*Response, error) {
-	response, err := c.do(ctx, url, opts...)
+	response, err := c.do(ctx, http.MethodGet, url, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	return newResponse(response), nil
+}
+
+// Head send HEAD request, the body of response is always empty
+func (c *Client) Head(ctx context.Context, url string, opts ...HeaderOption) (*Response, error) {
+	response, err := c.do(ctx, http.MethodHead, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResponse(response), nil
+}
+
+// Download stream body of GET request to w, body is limited by limiter of client
+func (c *Client) Download(ctx context.Context, url string, w io.Writer, opts ...HeaderOption) (*Response, error) {
+	response, err := c.do(ctx, http.MethodGet, url, append(opts, setDoNotParse())...)
+	if err != nil {
+		return nil, err
+	}
+	body := response.RawBody()
+	defer body.Close()
+
+	r := &Response{
+		code:   response.StatusCode(),
+		Header: response.Header(),
+	}
+	if r.code < http.StatusOK || r.code >= http.StatusMultipleChoices {
+		r.body, _ = io.ReadAll(io.LimitReader(body, 1<<20))
+		return r, fmt.Errorf("download %s: unexpected status code %d: %s", url, r.code, r.body)
+	}
+
+	r.size, err = io.Copy(w, c.limiter.Reader(body))
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func newResponse(response *resty.Response) *Response {
 	return &Response{
 		body:   response.Body(),
 		size:   response.Size(),
 		code:   response.StatusCode(),
 		Header: response.Header(),
-	}, nil
+	}
 }
 
-func (c *Client) do(_ context.Context, url string, opts ...HeaderOption) (*resty.Response, error) {
+func (c *Client) do(_ context.Context, method, url string, opts ...HeaderOption) (*resty.Response, error) {
 	if err := c.check(); err != nil {
 		return nil, err
 	}
@@ -91,8 +143,17 @@ func (c *Client) do(_ context.Context, url string, opts ...HeaderOption) (*resty
 	if header.authToken != "" {
 		client = client.SetAuthToken(header.authToken)
 	}
+	if header.username != "" {
+		client = client.SetBasicAuth(header.username, header.password)
+	}
+	for key, value := range header.headers {
+		client = client.SetHeader(key, value)
+	}
+	if header.doNotParse {
+		client = client.SetDoNotParseResponse(true)
+	}
 
-	response, err := client.Get(url)
+	response, err := client.Execute(method, url)
 	if err != nil {
 		return nil, err
 	}
@@ -100,9 +161,68 @@ func (c *Client) do(_ context.Context, url string, opts ...HeaderOption) (*resty
 	return response, nil
 }
 
+// Send send request with method, body set by SetBody is uploaded with its size and
+// limited by limiter of client, body of response is read
+func (c *Client) Send(ctx context.Context, method, url string, opts ...HeaderOption) (*Response, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+
+	var header Header
+	for _, opt := range opts {
+		opt(&header)
+	}
+
+	var body io.Reader = http.NoBody
+	if header.body != nil {
+		body = c.limiter.Reader(header.body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = header.size
+	if header.body == nil {
+		request.ContentLength = 0
+	}
+	if header.accept != "" {
+		request.Header.Set("Accept", header.accept)
+	}
+	if header.authToken != "" {
+		request.Header.Set("Authorization", "Bearer "+header.authToken)
+	}
+	if header.username != "" {
+		request.SetBasicAuth(header.username, header.password)
+	}
+	for key, value := range header.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := c.http.GetClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		body:   content,
+		size:   int64(len(content)),
+		code:   response.StatusCode,
+		Header: response.Header,
+	}, nil
+}
+
 func (c *Client) check() error {
 	if !c.proxy {
 		proxy := os.Getenv("https_proxy")
+		if proxy == "" {
+			return nil
+		}
 		return c.SetProxy(proxy)
 	}
 
@@ -129,10 +249,21 @@ func (r *Response) Size() int64 {
 	return r.size
 }
 
+// RateLimit parse rate limit headers of response
+func (r *Response) RateLimit() (*RateLimit, bool) {
+	return ParseRateLimit(r.Header)
+}
+
 type Header struct {
-	Url       string
-	accept    string
-	authToken string
+	Url        string
+	accept     string
+	authToken  string
+	doNotParse bool
+	username   string
+	password   string
+	headers    map[string]string
+	body       io.Reader
+	size       int64
 }
 
 type HeaderOption func(*Header)
@@ -149,8 +280,38 @@ func SetAuthToken(value string) HeaderOption {
 	}
 }
 
+// SetBasicAuth send credential with basic authentication
+func SetBasicAuth(username, password string) HeaderOption {
+	return func(h *Header) {
+		h.username, h.password = username, password
+	}
+}
+
+// SetHeader set header of request, such as `Content-Type`
+func SetHeader(key, value string) HeaderOption {
+	return func(h *Header) {
+		if h.headers == nil {
+			h.headers = make(map[string]string)
+		}
+		h.headers[key] = value
+	}
+}
+
+// SetBody set body of request sent by Send, size is sent as Content-Length
+func SetBody(body io.Reader, size int64) HeaderOption {
+	return func(h *Header) {
+		h.body, h.size = body, size
+	}
+}
+
+func setDoNotParse() HeaderOption {
+	return func(h *Header) {
+		h.doNotParse = true
+	}
+}
+
 func (c *Client) Header(ctx context.Context, url string) (*Header, error) {
-	response, err := c.do(ctx, url)
+	response, err := c.do(ctx, http.MethodGet, url)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+type (
+	// Index image index of OCI or manifest list of docker, which points to manifests of platforms
+	Index struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType,omitempty"`
+		ArtifactType  string            `json:"artifactType,omitempty"`
+		Manifests     []Descriptor      `json:"manifests"`
+		Subject       *Descriptor       `json:"subject,omitempty"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+		// Extra fields unknown to Index, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// Manifest image manifest of OCI or docker, config and layers are descriptors of blobs
+	Manifest struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType,omitempty"`
+		ArtifactType  string            `json:"artifactType,omitempty"`
+		Config        Descriptor        `json:"config"`
+		Layers        []Descriptor      `json:"layers"`
+		Subject       *Descriptor       `json:"subject,omitempty"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+		// Extra fields unknown to Manifest, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// ImageConfig config blob of image, docker specific fields such as `container_config` are kept in Extra
+	ImageConfig struct {
+		Created      *time.Time      `json:"created,omitempty"`
+		Author       string          `json:"author,omitempty"`
+		Architecture string          `json:"architecture"`
+		OS           string          `json:"os"`
+		OSVersion    string          `json:"os.version,omitempty"`
+		OSFeatures   []string        `json:"os.features,omitempty"`
+		Variant      string          `json:"variant,omitempty"`
+		Config       ContainerConfig `json:"config"`
+		RootFS       RootFS          `json:"rootfs"`
+		History      []History       `json:"history,omitempty"`
+		// Extra fields unknown to ImageConfig, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// ContainerConfig default config of containers running image
+	ContainerConfig struct {
+		User         string              `json:"User,omitempty"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+		Env          []string            `json:"Env,omitempty"`
+		Entrypoint   []string            `json:"Entrypoint,omitempty"`
+		Cmd          []string            `json:"Cmd,omitempty"`
+		Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+		WorkingDir   string              `json:"WorkingDir,omitempty"`
+		Labels       map[string]string   `json:"Labels,omitempty"`
+		StopSignal   string              `json:"StopSignal,omitempty"`
+		ArgsEscaped  bool                `json:"ArgsEscaped,omitempty"`
+		Healthcheck  *Healthcheck        `json:"Healthcheck,omitempty"`
+		OnBuild      []string            `json:"OnBuild,omitempty"`
+		Shell        []string            `json:"Shell,omitempty"`
+		// Extra fields unknown to ContainerConfig, such as `Hostname` of docker, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// Healthcheck command checking container, durations are nanoseconds in json like docker
+	Healthcheck struct {
+		Test          []string      `json:"Test,omitempty"`
+		Interval      time.Duration `json:"Interval,omitempty"`
+		Timeout       time.Duration `json:"Timeout,omitempty"`
+		StartPeriod   time.Duration `json:"StartPeriod,omitempty"`
+		StartInterval time.Duration `json:"StartInterval,omitempty"`
+		Retries       int           `json:"Retries,omitempty"`
+		// Extra fields unknown to Healthcheck, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// RootFS diff ids of uncompressed layers
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+		// Extra fields unknown to RootFS, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+
+	// History step which builds image, empty layer step doesn't change filesystem
+	History struct {
+		Created    *time.Time `json:"created,omitempty"`
+		CreatedBy  string     `json:"created_by,omitempty"`
+		Author     string     `json:"author,omitempty"`
+		Comment    string     `json:"comment,omitempty"`
+		EmptyLayer bool       `json:"empty_layer,omitempty"`
+		// Extra fields unknown to History, which are kept when marshaling
+		Extra map[string]json.RawMessage `json:"-"`
+	}
+)
+
+// ExposedPortList return sorted exposed ports like `80/tcp`
+func (c *ContainerConfig) ExposedPortList() []string {
+	ports := make([]string, 0, len(c.ExposedPorts))
+	for port := range c.ExposedPorts {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+func (i *Index) UnmarshalJSON(content []byte) error {
+	type index Index
+	extra, err := unmarshalExtra(content, (*index)(i))
+	i.Extra = extra
+	return err
+}
+
+func (i Index) MarshalJSON() ([]byte, error) {
+	type index Index
+	return marshalExtra(index(i), i.Extra)
+}
+
+func (m *Manifest) UnmarshalJSON(content []byte) error {
+	type manifest Manifest
+	extra, err := unmarshalExtra(content, (*manifest)(m))
+	m.Extra = extra
+	return err
+}
+
+func (m Manifest) MarshalJSON() ([]byte, error) {
+	type manifest Manifest
+	return marshalExtra(manifest(m), m.Extra)
+}
+
+func (c *ImageConfig) UnmarshalJSON(content []byte) error {
+	type config ImageConfig
+	extra, err := unmarshalExtra(content, (*config)(c))
+	c.Extra = extra
+	return err
+}
+
+func (c ImageConfig) MarshalJSON() ([]byte, error) {
+	type config ImageConfig
+	return marshalExtra(config(c), c.Extra)
+}
+
+func (c *ContainerConfig) UnmarshalJSON(content []byte) error {
+	type config ContainerConfig
+	extra, err := unmarshalExtra(content, (*config)(c))
+	c.Extra = extra
+	return err
+}
+
+func (c ContainerConfig) MarshalJSON() ([]byte, error) {
+	type config ContainerConfig
+	return marshalExtra(config(c), c.Extra)
+}
+
+func (d *Descriptor) UnmarshalJSON(content []byte) error {
+	type descriptor Descriptor
+	extra, err := unmarshalExtra(content, (*descriptor)(d))
+	d.Extra = extra
+	return err
+}
+
+func (d Descriptor) MarshalJSON() ([]byte, error) {
+	type descriptor Descriptor
+	return marshalExtra(descriptor(d), d.Extra)
+}
+
+func (h *Healthcheck) UnmarshalJSON(content []byte) error {
+	type healthcheck Healthcheck
+	extra, err := unmarshalExtra(content, (*healthcheck)(h))
+	h.Extra = extra
+	return err
+}
+
+func (h Healthcheck) MarshalJSON() ([]byte, error) {
+	type healthcheck Healthcheck
+	return marshalExtra(healthcheck(h), h.Extra)
+}
+
+func (r *RootFS) UnmarshalJSON(content []byte) error {
+	type rootFS RootFS
+	extra, err := unmarshalExtra(content, (*rootFS)(r))
+	r.Extra = extra
+	return err
+}
+
+func (r RootFS) MarshalJSON() ([]byte, error) {
+	type rootFS RootFS
+	return marshalExtra(rootFS(r), r.Extra)
+}
+
+func (h *History) UnmarshalJSON(content []byte) error {
+	type history History
+	extra, err := unmarshalExtra(content, (*history)(h))
+	h.Extra = extra
+	return err
+}
+
+func (h History) MarshalJSON() ([]byte, error) {
+	type history History
+	return marshalExtra(history(h), h.Extra)
+}
+
+func (p *Platform) UnmarshalJSON(content []byte) error {
+	type platform Platform
+	extra, err := unmarshalExtra(content, (*platform)(p))
+	p.Extra = extra
+	return err
+}
+
+func (p Platform) MarshalJSON() ([]byte, error) {
+	type platform Platform
+	return marshalExtra(platform(p), p.Extra)
+}
+
+// Platform return platform image runs on
+func (c *ImageConfig) Platform() *Platform {
+	return &Platform{
+		Architecture: c.Architecture,
+		OS:           c.OS,
+		Variant:      c.Variant,
+		OSVersion:    c.OSVersion,
+		OSFeatures:   c.OSFeatures,
+	}
+}
+
+// unmarshalExtra decode content to v, and return fields which aren't fields of v
+func unmarshalExtra(content []byte, v any) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(content, v); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bytes.TrimSpace(content), []byte("null")) {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+
+	known := jsonFields(reflect.TypeOf(v).Elem())
+	for key := range fields {
+		if isField(known, key) {
+			delete(fields, key)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// marshalExtra encode v and append extra fields in order of keys after fields of v, fields of v win
+func marshalExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	content, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return content, err
+	}
+
+	known := jsonFields(reflect.TypeOf(v))
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		if !isField(known, key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	buf := bytes.NewBuffer(content[:len(content)-1])
+	for index, key := range keys {
+		if index > 0 || len(content) > 2 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		if err := json.Compact(buf, extra[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// jsonFields return json names of fields of struct type t
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFields(field.Type)...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// isField check whether key is one of names, keys are matched case-insensitively like encoding/json
+func isField(names []string, key string) bool {
+	return slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, key) })
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestImageConfigRoundTrip(t *testing.T) {
+	content := `{"architecture":"arm64","os":"linux","variant":"v8","config":{"ExposedPorts":{"443/tcp":{},"80/tcp":{}},"Volumes":{"/data":{}},` +
+		`"Healthcheck":{"Test":["CMD","true"],"Interval":30000000000,"Retries":3,"x-check":"h"},"Hostname":"","StopTimeout":10},` +
+		`"rootfs":{"type":"layers","diff_ids":["sha256:a"],"x-rootfs":1},"history":[{"created_by":"sh","x-history":true}],` +
+		`"container_config":{"Cmd":["sh"]},"docker_version":"24.0.7"}`
+
+	var config ImageConfig
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Config.ExposedPortList(), []string{"443/tcp", "80/tcp"}) {
+		t.Fatalf("unexpected ports: %v", config.Config.ExposedPorts)
+	}
+	if config.Config.Healthcheck.Interval != 30*time.Second || config.Config.Healthcheck.Retries != 3 {
+		t.Fatalf("unexpected healthcheck: %+v", config.Config.Healthcheck)
+	}
+	if len(config.Extra) != 2 || len(config.Config.Extra) != 2 {
+		t.Fatalf("unexpected extra fields: %v, %v", config.Extra, config.Config.Extra)
+	}
+	if config.Config.Healthcheck.Extra["x-check"] == nil || config.RootFS.Extra["x-rootfs"] == nil || config.History[0].Extra["x-history"] == nil {
+		t.Fatalf("unknown fields of nested objects are lost: %+v", config)
+	}
+	if platform := config.Platform(); platform.String() != "linux/arm64/v8" || platform.Extra != nil {
+		t.Fatalf("unexpected platform: %+v", platform)
+	}
+
+	marshaled, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want map[string]any
+	json.Unmarshal(marshaled, &got)
+	json.Unmarshal([]byte(content), &want)
+	if gotJson, wantJson := mustMarshal(t, got), mustMarshal(t, want); gotJson != wantJson {
+		t.Fatalf("fields are lost:\ngot  %s\nwant %s", gotJson, wantJson)
+	}
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	content := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"digest":"sha256:b","size":10,"platform":{"architecture":"amd64","os":"linux","x-platform":"p"},"x-custom":true}],"annotations":{"a":"b"},"x-index":[1]}`
+
+	var index Index
+	if err := json.Unmarshal([]byte(content), &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Manifests[0].Platform.String() != "linux/amd64" || index.Annotations["a"] != "b" {
+		t.Fatalf("unexpected index: %+v", index)
+	}
+
+	marshaled, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// known fields keep their order, unknown fields follow them
+	if string(marshaled) != content {
+		t.Fatalf("unexpected index:\ngot  %s\nwant %s", marshaled, content)
+	}
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -1,66 +1,10 @@
 package http
 
 import (
-	"fmt"
+	"encoding/json"
 	"time"
 )
 
-type AutoGenerated struct {
-	SchemaVersion int    `json:"schemaVersion"`
-	MediaType     string `json:"mediaType"`
-	Config        struct {
-		MediaType string `json:"mediaType"`
-		Digest    string `json:"digest"`
-		Size      int    `json:"size"`
-	} `json:"config"`
-	Layers []struct {
-		MediaType string `json:"mediaType"`
-		Digest    string `json:"digest"`
-		Size      int    `json:"size"`
-	} `json:"layers"`
-	Annotations struct {
-		ComDockerOfficialImagesBashbrewArch string    `json:"com.docker.official-images.bashbrew.arch"`
-		OrgOpencontainersImageBaseDigest    string    `json:"org.opencontainers.image.base.digest"`
-		OrgOpencontainersImageBaseName      string    `json:"org.opencontainers.image.base.name"`
-		OrgOpencontainersImageCreated       time.Time `json:"org.opencontainers.image.created"`
-		OrgOpencontainersImageRevision      string    `json:"org.opencontainers.image.revision"`
-		OrgOpencontainersImageSource        string    `json:"org.opencontainers.image.source"`
-		OrgOpencontainersImageURL           string    `json:"org.opencontainers.image.url"`
-		OrgOpencontainersImageVersion       string    `json:"org.opencontainers.image.version"`
-	} `json:"annotations"`
-}
-
-type DigestModel struct {
-	Architecture string `json:"architecture"`
-	Config       struct {
-		ExposedPorts struct {
-			Eight0TCP struct {
-			} `json:"80/tcp"`
-		} `json:"ExposedPorts"`
-		Env        []string `json:"Env"`
-		Entrypoint []string `json:"Entrypoint"`
-		Cmd        []string `json:"Cmd"`
-		WorkingDir string   `json:"WorkingDir"`
-		Labels     struct {
-			Maintainer string `json:"maintainer"`
-		} `json:"Labels"`
-		StopSignal string `json:"StopSignal"`
-	} `json:"config"`
-	Created time.Time `json:"created"`
-	History []struct {
-		Created    time.Time `json:"created"`
-		CreatedBy  string    `json:"created_by"`
-		Comment    string    `json:"comment"`
-		EmptyLayer bool      `json:"empty_layer,omitempty"`
-	} `json:"history"`
-	Os     string `json:"os"`
-	Rootfs struct {
-		Type    string   `json:"type"`
-		DiffIds []string `json:"diff_ids"`
-	} `json:"rootfs"`
-	Variant string `json:"variant"`
-}
-
 type TokenInfo struct {
 	Token       string    `json:"token"`
 	AccessToken string    `json:"access_token"`
@@ -68,24 +12,64 @@ type TokenInfo struct {
 	IssuedAt    time.Time `json:"issued_at"`
 }
 
-type Manifest struct {
-	Arch      string `json:"arch"`
-	Digest    string `json:"digest"`
-	MediaType string `json:"mediaType"`
+// defaultTokenExpiresIn lifetime of token if token server doesn't report it, which is 60s by distribution spec
+const defaultTokenExpiresIn = 60
+
+// Expiry return time token expires, which is counted from now rather than IssuedAt as clocks may differ,
+// it's zero if there isn't token
+func (t *TokenInfo) Expiry(now time.Time) time.Time {
+	if t.Token == "" && t.AccessToken == "" {
+		return time.Time{}
+	}
+
+	expiresIn := t.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = defaultTokenExpiresIn
+	}
+	return now.Add(time.Duration(expiresIn) * time.Second)
 }
 
+// RootManifest item of manifest.json in docker-archive
 type RootManifest struct {
 	Config   string   `json:"Config"`
 	RepoTags []string `json:"RepoTags"`
 	Layers   []string `json:"Layers"`
+	// LayerSources registry descriptor of each layer keyed by diff id
+	LayerSources map[string]Descriptor `json:"LayerSources,omitempty"`
+}
+
+// Descriptor describe content addressed blob
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	URLs        []string          `json:"urls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	// ArtifactType type of artifact when descriptor points to artifact manifest
+	ArtifactType string `json:"artifactType,omitempty"`
+	// Data embedded content of blob
+	Data []byte `json:"data,omitempty"`
+	// Extra fields unknown to Descriptor, which are kept when marshaling
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-type AuthMD struct {
-	AuthUrl string `json:"auth_url"`
-	Service string `json:"service"`
-	Scope   string `json:"scope"`
+// Platform which image runs on
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	Variant      string   `json:"variant,omitempty"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	// Extra fields unknown to Platform, which are kept when marshaling
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
-func (a *AuthMD) BuildAuthUrl() string {
-	return fmt.Sprintf("%s?service=%s&scope=%s", a.AuthUrl, a.Service, a.Scope)
+// String return platform like `linux/arm64/v8`
+func (p *Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
 }
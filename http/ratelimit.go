@@ -0,0 +1,98 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RateLimitLimit     = "Ratelimit-Limit"
+	RateLimitRemaining = "Ratelimit-Remaining"
+	RateLimitSource    = "Docker-Ratelimit-Source"
+	RetryAfter         = "Retry-After"
+)
+
+// RateLimit pull quota reported by registry, such as `ratelimit-limit: 100;w=21600`
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+	Source    string
+}
+
+// ParseRateLimit read rate limit from response header, return false if registry doesn't report it
+func ParseRateLimit(header http.Header) (*RateLimit, bool) {
+	limitValue := header.Get(RateLimitLimit)
+	remainingValue := header.Get(RateLimitRemaining)
+	if limitValue == "" && remainingValue == "" {
+		return nil, false
+	}
+
+	var rl RateLimit
+	rl.Limit, rl.Window = parseRateLimitValue(limitValue)
+	remaining, window := parseRateLimitValue(remainingValue)
+	rl.Remaining = remaining
+	if rl.Window == 0 {
+		rl.Window = window
+	}
+	rl.Source = header.Get(RateLimitSource)
+
+	return &rl, true
+}
+
+// parseRateLimitValue parse value like `100;w=21600`
+func parseRateLimitValue(value string) (int, time.Duration) {
+	var (
+		count  int
+		window time.Duration
+	)
+	for index, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if index == 0 {
+			count, _ = strconv.Atoi(part)
+			continue
+		}
+		if seconds, ok := strings.CutPrefix(part, "w="); ok {
+			if n, err := strconv.Atoi(seconds); err == nil {
+				window = time.Duration(n) * time.Second
+			}
+		}
+	}
+
+	return count, window
+}
+
+// ParseRetryAfter read `Retry-After` header with seconds or http date
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get(RetryAfter))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func (r *RateLimit) String() string {
+	s := fmt.Sprintf("%d/%d remaining", r.Remaining, r.Limit)
+	if r.Window > 0 {
+		s += fmt.Sprintf(" per %s", r.Window)
+	}
+	if r.Source != "" {
+		s += fmt.Sprintf(" (source: %s)", r.Source)
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	header := http.Header{}
+	header.Set(RateLimitLimit, "100;w=21600")
+	header.Set(RateLimitRemaining, "76;w=21600")
+	header.Set(RateLimitSource, "1.2.3.4")
+
+	rl, ok := ParseRateLimit(header)
+	if !ok {
+		t.Fatal("rate limit not found")
+	}
+	if rl.Limit != 100 || rl.Remaining != 76 || rl.Window != 6*time.Hour || rl.Source != "1.2.3.4" {
+		t.Fatalf("unexpected rate limit: %+v", rl)
+	}
+
+	if _, ok := ParseRateLimit(http.Header{}); ok {
+		t.Fatal("expected no rate limit")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set(RetryAfter, "30")
+	if d, ok := ParseRetryAfter(header, now); !ok || d != 30*time.Second {
+		t.Fatalf("unexpected retry after: %s", d)
+	}
+
+	header.Set(RetryAfter, now.Add(time.Minute).Format(http.TimeFormat))
+	if d, ok := ParseRetryAfter(header, now); !ok || d != time.Minute {
+		t.Fatalf("unexpected retry after: %s", d)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anoyah/downer/core"
+	"github.com/anoyah/downer/tools"
+)
+
+// runInspect print metadata of image without downloading layers
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	arch := fs.String("arch", "", "--arch linux/arm64, all platforms are inspected by default")
+	asJson := fs.Bool("json", false, "--json")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	creds := fs.String("creds", "", "--creds user:password, credential of docker login is used by default")
+	var insecure stringsFlag
+	fs.Var(&insecure, "insecure-registry", "--insecure-registry localhost:5000, registry served with plain http, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer inspect <reference> [flags]")
+		fs.PrintDefaults()
+	}
+	reference, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+
+	inspected, err := core.Inspect(&core.Config{
+		Name:        reference,
+		Arch:        *arch,
+		Proxy:       *proxy,
+		Debug:       *verbose,
+		Credentials: *creds,
+		Insecure:    insecure,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(inspected)
+	}
+	printInspected(inspected)
+	return nil
+}
+
+// printInspected print inspected image as text, platforms are separated by blank line
+func printInspected(inspected *core.Inspected) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Name:\t%s\n", inspected.Reference)
+	fmt.Fprintf(w, "Digest:\t%s\n", inspected.Digest)
+	fmt.Fprintf(w, "MediaType:\t%s\n", inspected.MediaType)
+	platforms := make([]string, 0, len(inspected.Platforms))
+	for _, platform := range inspected.Platforms {
+		platforms = append(platforms, platform.Platform)
+	}
+	fmt.Fprintf(w, "Platforms:\t%s\n", strings.Join(platforms, ", "))
+
+	for _, platform := range inspected.Platforms {
+		fmt.Fprintf(w, "\nPlatform:\t%s\n", platform.Platform)
+		fmt.Fprintf(w, "Manifest:\t%s\n", platform.Digest)
+		fmt.Fprintf(w, "Config:\t%s\n", platform.Config.Digest)
+		if platform.Created != nil {
+			fmt.Fprintf(w, "Created:\t%s\n", platform.Created.Format(time.RFC3339))
+		}
+		if platform.User != "" {
+			fmt.Fprintf(w, "User:\t%s\n", platform.User)
+		}
+		if platform.WorkingDir != "" {
+			fmt.Fprintf(w, "WorkingDir:\t%s\n", platform.WorkingDir)
+		}
+		if platform.Entrypoint != nil {
+			fmt.Fprintf(w, "Entrypoint:\t%q\n", platform.Entrypoint)
+		}
+		if platform.Cmd != nil {
+			fmt.Fprintf(w, "Cmd:\t%q\n", platform.Cmd)
+		}
+		if len(platform.ExposedPorts) > 0 {
+			fmt.Fprintf(w, "ExposedPorts:\t%s\n", strings.Join(platform.ExposedPorts, ", "))
+		}
+		if len(platform.Env) > 0 {
+			fmt.Fprintf(w, "Env:\n")
+			for _, env := range platform.Env {
+				fmt.Fprintf(w, "  %s\n", env)
+			}
+		}
+		if len(platform.Labels) > 0 {
+			fmt.Fprintf(w, "Labels:\n")
+			keys := make([]string, 0, len(platform.Labels))
+			for key := range platform.Labels {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "  %s=%s\n", key, platform.Labels[key])
+			}
+		}
+
+		fmt.Fprintf(w, "Layers:\t%d, %s compressed\n", len(platform.Layers), tools.HumanSize(platform.Size))
+		for _, layer := range platform.Layers {
+			fmt.Fprintf(w, "  %s  %s\n", layer.Digest, tools.HumanSize(layer.Size))
+		}
+		if len(platform.History) > 0 {
+			fmt.Fprintf(w, "History:\n")
+			for _, history := range platform.History {
+				created := ""
+				if history.Created != nil {
+					created = history.Created.Format(time.DateTime)
+				}
+				createdBy := strings.ReplaceAll(history.CreatedBy, "\t", " ")
+				if history.EmptyLayer {
+					createdBy += " (empty layer)"
+				}
+				fmt.Fprintf(w, "  %-19s  %s\n", created, createdBy)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anoyah/downer/compress"
+	"github.com/anoyah/downer/tools"
+)
+
+// runJoin check parts of split archive and rebuild it, `-o -` streams it to stdout
+func runJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	output := fs.String("output", "", "--output ./images/xx.tar.gz, `-` streams archive to stdout")
+	fs.StringVar(output, "o", "", "shorthand of --output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer join <archive.parts.json> [-o output]")
+		fs.PrintDefaults()
+	}
+	manifest, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(manifest, compress.PartsSuffix)
+	}
+	if *output == "-" {
+		return compress.Join(manifest, os.Stdout)
+	}
+
+	if _, err := os.Stat(*output); err == nil {
+		return fmt.Errorf("%w: %s", tools.ErrFileExist, *output)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = compress.Join(manifest, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	fmt.Printf("joined archive: %s\n", *output)
+	return nil
+}
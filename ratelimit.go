@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/anoyah/downer/core"
+)
+
+// runRateLimit check remaining pull quota without pulling
+func runRateLimit(args []string) error {
+	fs := flag.NewFlagSet("ratelimit", flag.ExitOnError)
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rl, err := core.CheckRateLimit(&core.Config{
+		Proxy: *proxy,
+		Debug: *verbose,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rate limit: %s\n", rl)
+	return nil
+}
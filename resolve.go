@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoyah/downer/core"
+)
+
+// runResolve print digest which reference points to
+func runResolve(args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	platforms := fs.Bool("platforms", false, "--platforms, print digests of manifests of platforms too")
+	asJson := fs.Bool("json", false, "--json")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	creds := fs.String("creds", "", "--creds user:password, credential of docker login is used by default")
+	var insecure stringsFlag
+	fs.Var(&insecure, "insecure-registry", "--insecure-registry localhost:5000, registry served with plain http, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer resolve <reference> [flags]")
+		fs.PrintDefaults()
+	}
+	reference, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := core.NewResolver(&core.Config{
+		Proxy:       *proxy,
+		Debug:       *verbose,
+		Credentials: *creds,
+		Insecure:    insecure,
+	})
+	if err != nil {
+		return err
+	}
+	resolve := resolver.Resolve
+	if *platforms {
+		resolve = resolver.ResolvePlatforms
+	}
+	resolved, err := resolve(reference)
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resolved)
+	}
+	fmt.Println(resolved.Digest)
+	for _, platform := range resolved.Platforms {
+		fmt.Printf("%s\t%s\n", platform.Platform, platform.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anoyah/downer/core"
+	"github.com/anoyah/downer/tools"
+)
+
+// runSync mirror repositories listed in sync file, once or every interval
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	report := fs.String("report", "", "--report ./sync-report.json, overrides report of sync file")
+	interval := fs.String("interval", "", "--interval 6h, sync repeatedly, sync once by default")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	limitRate := fs.String("limit-rate", "", "--limit-rate 5M")
+	cacheDir := fs.String("cache-dir", "", "--cache-dir ~/.cache/downer")
+	noCache := fs.Bool("no-cache", false, "--no-cache")
+	srcCreds := fs.String("src-creds", "", "--src-creds user:password, credential of docker login is used by default")
+	destCreds := fs.String("dest-creds", "", "--dest-creds user:password, credential of docker login is used by default")
+	chunkSize := fs.String("chunk-size", "", "--chunk-size 16M, upload blobs larger than it with chunks")
+	var insecure stringsFlag
+	fs.Var(&insecure, "insecure-registry", "--insecure-registry localhost:5000, registry served with plain http, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer sync <sync.yaml> [flags]")
+		fs.PrintDefaults()
+	}
+	file, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var every time.Duration
+	if *interval != "" {
+		if every, err = tools.ParseDuration(*interval); err != nil || every <= 0 {
+			return fmt.Errorf("invalid interval: %s", *interval)
+		}
+	}
+
+	cfg := &core.SyncConfig{
+		Config: core.Config{
+			Proxy:       *proxy,
+			Debug:       *verbose,
+			LimitRate:   *limitRate,
+			CacheDir:    *cacheDir,
+			NoCache:     *noCache,
+			Credentials: *srcCreds,
+			Insecure:    insecure,
+		},
+		File:            file,
+		Report:          *report,
+		DestCredentials: *destCreds,
+		ChunkSize:       *chunkSize,
+	}
+	for {
+		result, err := core.Sync(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Print(result.Summary())
+		if every == 0 {
+			if result.Failed > 0 {
+				return errors.New("some tags failed to sync")
+			}
+			return nil
+		}
+
+		fmt.Printf("next sync at %s\n", time.Now().Add(every).Format(time.DateTime))
+		time.Sleep(every)
+	}
+}
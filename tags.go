@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anoyah/downer/core"
+	"github.com/anoyah/downer/tools"
+)
+
+// runTags list tags of repository
+func runTags(args []string) error {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	filter := fs.String("filter", "", "--filter '^1\\.25\\.', regex which tags match")
+	sort := fs.String("sort", "", "--sort semver, tags are listed in order of registry by default")
+	latest := fs.String("latest-matching", "", "--latest-matching '~1.25', print the greatest version in range only")
+	asJson := fs.Bool("json", false, "--json")
+	proxy := fs.String("proxy", "", "--proxy http://127.0.0.1.7890")
+	verbose := fs.Bool("verbose", false, "--verbose")
+	creds := fs.String("creds", "", "--creds user:password, credential of docker login is used by default")
+	var insecure stringsFlag
+	fs.Var(&insecure, "insecure-registry", "--insecure-registry localhost:5000, registry served with plain http, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: downer tags <repository> [flags]")
+		fs.PrintDefaults()
+	}
+	name, err := parsePositional(fs, args)
+	if err != nil {
+		return err
+	}
+	if *sort != "" && *sort != "semver" {
+		return fmt.Errorf("unsupported sort: %s", *sort)
+	}
+	ref, err := tools.ParseReference(name)
+	if err != nil {
+		return err
+	}
+
+	tags, err := core.Tags(&core.TagsConfig{
+		Config: core.Config{
+			Name:        name,
+			Proxy:       *proxy,
+			Debug:       *verbose,
+			NoCache:     true,
+			Credentials: *creds,
+			Insecure:    insecure,
+		},
+		Regex:          *filter,
+		SortSemver:     *sort == "semver",
+		LatestMatching: *latest,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]any{"name": ref.Name(), "tags": tags})
+	}
+	for _, tag := range tags {
+		fmt.Println(tag)
+	}
+	return nil
+}
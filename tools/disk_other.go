@@ -0,0 +1,10 @@
+//go:build !unix
+
+package tools
+
+import "errors"
+
+// DiskFree isn't supported on this platform
+func DiskFree(path string) (int64, uint64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package tools
+
+import (
+	"syscall"
+)
+
+// DiskFree return free space for unprivileged users and device id of filesystem of path,
+// path is looked up from its nearest existing parent
+func DiskFree(path string) (int64, uint64, error) {
+	path = ExistingParent(path)
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(fs.Bavail) * int64(fs.Bsize), uint64(st.Dev), nil
+}
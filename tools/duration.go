@@ -0,0 +1,21 @@
+package tools
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration extend time.ParseDuration with day `d` and week `w` units, such as `30d`
+func ParseDuration(s string) (time.Duration, error) {
+	value := strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			if count, err := strconv.ParseFloat(n, 64); err == nil {
+				return time.Duration(count * float64(unit)), nil
+			}
+		}
+	}
+
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"90m":  90 * time.Minute,
+		"-1d":  -24 * time.Hour,
+		" 6h ": 6 * time.Hour,
+	}
+	for input, want := range cases {
+		got, err := ParseDuration(input)
+		if err != nil {
+			t.Fatalf("parse %q: %s", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: got %s, want %s", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"abc", "d", "1x", ""} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
@@ -5,4 +5,18 @@ import "errors"
 var (
 	// 文件不存在
 	ErrFileExist = errors.New("the file already exists, please rename output file")
+	// 触发仓库限流
+	ErrRateLimited = errors.New("too many requests, registry rate limit exceeded, use --wait-ratelimit to wait for reset")
+	// 仓库没有返回限流信息
+	ErrNoRateLimit = errors.New("registry doesn't report rate limit")
+	// 离线模式禁止网络请求
+	ErrOffline = errors.New("network request is not allowed in offline mode")
+	// 离线模式缓存中没有镜像
+	ErrNotCached = errors.New("image is not found in cache")
+	// 离线模式缓存中缺少 blob
+	ErrBlobsMissing = errors.New("blobs are missing in cache")
+	// 文件校验和不匹配
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// 磁盘剩余空间不足
+	ErrNoSpace = errors.New("not enough free disk space")
 )
@@ -2,12 +2,15 @@ package tools
 
 import (
 	"crypto/sha256"
-	"encoding/hex"
+	"fmt"
 )
 
-// GenLayerID generate id with layer
-func GenLayerID(parentID, ublob string) string {
-	data := parentID + "-" + ublob
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+// ChainID generate chain id of layer with chain id of parent and diff id of layer,
+// chain id of the first layer is its diff id
+func ChainID(parent, diffID string) string {
+	if parent == "" {
+		return diffID
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(parent+" "+diffID)))
 }
@@ -2,9 +2,14 @@ package tools
 
 import "testing"
 
-func TestGenID(t *testing.T) {
-	id := GenLayerID("parent id", "current id")
-	if id == "" {
-		t.Fail()
+func TestChainID(t *testing.T) {
+	diffID := "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"
+	if id := ChainID("", diffID); id != diffID {
+		t.Fatalf("chain id of base layer should be diff id: %s", id)
+	}
+
+	id := ChainID(diffID, diffID)
+	if id == diffID || len(id) != len(diffID) {
+		t.Fatalf("unexpected chain id: %s", id)
 	}
 }
@@ -32,3 +32,18 @@ func CreatePathWithFilepath(fp string) error {
 	}
 	return nil
 }
+
+// ExistingParent return path itself if it exists, or its nearest existing parent
+func ExistingParent(path string) string {
+	path, _ = filepath.Abs(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultRegistry = "docker.io"
+	DefaultLibrary  = "library"
+	DefaultTag      = "latest"
+
+	legacyRegistry = "index.docker.io"
+)
+
+var (
+	repositoryRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegexp        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference normalized image reference, such as `docker.io/library/nginx:alpine`
+type Reference struct {
+	// Registry host of registry, `docker.io` for Docker Hub
+	Registry string
+	// Repository path of repository, such as `library/nginx`
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parse and normalize image reference the same way as docker:
+// `nginx` -> `docker.io/library/nginx:latest`, `neosmemo/memos:stable` ->
+// `docker.io/neosmemo/memos:stable`, `ghcr.io/org/app@sha256:...` keeps registry
+func ParseReference(s string) (*Reference, error) {
+	var ref Reference
+	name := strings.TrimSpace(s)
+
+	if index := strings.Index(name, "@"); index >= 0 {
+		ref.Digest = name[index+1:]
+		name = name[:index]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("invalid digest of reference %q", s)
+		}
+	}
+
+	if index := strings.LastIndex(name, ":"); index >= 0 && !strings.Contains(name[index:], "/") {
+		ref.Tag = name[index+1:]
+		name = name[:index]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("invalid tag of reference %q", s)
+		}
+	}
+
+	domain, remainder, ok := strings.Cut(name, "/")
+	if !ok || (!strings.ContainsAny(domain, ".:") && domain != "localhost" && strings.ToLower(domain) == domain) {
+		domain, remainder = DefaultRegistry, name
+	}
+	if domain == legacyRegistry {
+		domain = DefaultRegistry
+	}
+	if domain == DefaultRegistry && !strings.Contains(remainder, "/") {
+		remainder = DefaultLibrary + "/" + remainder
+	}
+	if !repositoryRegexp.MatchString(remainder) {
+		return nil, fmt.Errorf("invalid repository of reference %q", s)
+	}
+
+	ref.Registry = domain
+	ref.Repository = remainder
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+
+	return &ref, nil
+}
+
+// Name return full name of repository, such as `docker.io/library/nginx`
+func (r *Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// FamiliarName return name shown by docker, such as `nginx`, `neosmemo/memos`, `ghcr.io/org/app`
+func (r *Reference) FamiliarName() string {
+	if r.Registry != DefaultRegistry {
+		return r.Name()
+	}
+
+	return strings.TrimPrefix(r.Repository, DefaultLibrary+"/")
+}
+
+// ShortName return the last component of repository, such as `memos`
+func (r *Reference) ShortName() string {
+	return r.Repository[strings.LastIndex(r.Repository, "/")+1:]
+}
+
+// Reference return digest, or tag if digest is empty, which is used to request manifest, so
+// `nginx:1.25@sha256:...` is pinned to the digest
+func (r *Reference) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+// String return full reference, such as `docker.io/library/nginx:alpine`
+func (r *Reference) String() string {
+	return r.format(r.Name())
+}
+
+// Familiar return reference shown by docker, such as `nginx:alpine`, `neosmemo/memos:stable`
+func (r *Reference) Familiar() string {
+	return r.format(r.FamiliarName())
+}
+
+func (r *Reference) format(name string) string {
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+
+	return name
+}
@@ -0,0 +1,62 @@
+package tools
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		input    string
+		full     string
+		familiar string
+	}{
+		{"nginx", "docker.io/library/nginx:latest", "nginx:latest"},
+		{"nginx:alpine", "docker.io/library/nginx:alpine", "nginx:alpine"},
+		{"neosmemo/memos:stable", "docker.io/neosmemo/memos:stable", "neosmemo/memos:stable"},
+		{"docker.io/library/nginx:1.25", "docker.io/library/nginx:1.25", "nginx:1.25"},
+		{"index.docker.io/neosmemo/memos", "docker.io/neosmemo/memos:latest", "neosmemo/memos:latest"},
+		{"ghcr.io/org/app:1", "ghcr.io/org/app:1", "ghcr.io/org/app:1"},
+		{"localhost:5000/app", "localhost:5000/app:latest", "localhost:5000/app:latest"},
+		{
+			"quay.io/org/sub/app@sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+			"quay.io/org/sub/app@sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+			"quay.io/org/sub/app@sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+		},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.input)
+		if err != nil {
+			t.Fatalf("parse %s: %s", c.input, err)
+		}
+		if ref.String() != c.full || ref.Familiar() != c.familiar {
+			t.Fatalf("parse %s: got %s and %s", c.input, ref.String(), ref.Familiar())
+		}
+	}
+
+	// digest pins tag
+	digest := "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"
+	for input, want := range map[string]string{"nginx:1.25": "1.25", "nginx@" + digest: digest, "nginx:1.25@" + digest: digest} {
+		ref, err := ParseReference(input)
+		if err != nil {
+			t.Fatalf("parse %s: %s", input, err)
+		}
+		if ref.Reference() != want {
+			t.Fatalf("reference of %s: got %s, want %s", input, ref.Reference(), want)
+		}
+	}
+
+	for _, input := range []string{"", "Nginx", "nginx:al pine", "nginx@sha256:123"} {
+		if _, err := ParseReference(input); err == nil {
+			t.Fatalf("parse %q: expected error", input)
+		}
+	}
+}
+
+func TestSplitRepoTag(t *testing.T) {
+	name, tag := SplitRepoTag("localhost:5000/app")
+	if name != "localhost:5000/app" || tag != "latest" {
+		t.Fatalf("unexpected split: %s %s", name, tag)
+	}
+	name, tag = SplitRepoTag("ghcr.io/org/app:1")
+	if name != "ghcr.io/org/app" || tag != "1" {
+		t.Fatalf("unexpected split: %s %s", name, tag)
+	}
+}
@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Version semantic version of tag, such as `1.25.3`, `v2.0.0-rc.1`, missing minor or patch is 0
+	Version struct {
+		Major, Minor, Patch int
+		// Pre pre-release after `-`, such as `rc.1`, `alpine`
+		Pre string
+	}
+
+	// Constraint semantic version range, such as `~1.25`, `^2`, `>=1.2 <1.4`, `1.24.x || 1.26.x`
+	Constraint struct {
+		// sets any of which is matched, comparators of set are all matched
+		sets [][]comparator
+	}
+
+	comparator struct {
+		op      string
+		version Version
+	}
+)
+
+// ParseVersion parse tag as semantic version, leading `v` and build metadata after `+` are ignored
+func ParseVersion(s string) (Version, error) {
+	core, _, _ := strings.Cut(s, "-")
+	if strings.ContainsAny(core, "xX*") {
+		return Version{}, fmt.Errorf("invalid version: %q", s)
+	}
+	version, _, err := parsePartial(s)
+	return version, err
+}
+
+// parsePartial parse version whose missing or wildcard parts are -1, such as `1.25` -> 1, 25, -1
+func parsePartial(s string) (Version, []int, error) {
+	var version Version
+	value := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	value, _, _ = strings.Cut(value, "+")
+	value, version.Pre, _ = strings.Cut(value, "-")
+
+	fields := strings.Split(value, ".")
+	if value == "" || len(fields) > 3 {
+		return Version{}, nil, fmt.Errorf("invalid version: %q", s)
+	}
+	parts := []int{-1, -1, -1}
+	for index, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || (len(field) > 1 && field[0] == '0') {
+			return Version{}, nil, fmt.Errorf("invalid version: %q", s)
+		}
+		parts[index] = n
+	}
+	for index := range parts {
+		if index > 0 && parts[index-1] < 0 {
+			// parts after wildcard are wildcard
+			parts[index] = -1
+		}
+	}
+
+	version.Major, version.Minor, version.Patch = max(parts[0], 0), max(parts[1], 0), max(parts[2], 0)
+	return version, parts, nil
+}
+
+// String return version like `1.25.3-rc.1`
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare return -1, 0 or 1 if v is less than, equal to or greater than other,
+// pre-release is less than its release
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, other.Pre)
+}
+
+// comparePre compare dot separated identifiers, numeric identifiers are less than others
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for index := 0; index < len(as) && index < len(bs); index++ {
+		an, aErr := strconv.Atoi(as[index])
+		bn, bErr := strconv.Atoi(bs[index])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[index], bs[index]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// ParseConstraint parse range of versions the same as npm: `~1.25` is `>=1.25.0 <1.26.0`,
+// `^1.2` is `>=1.2.0 <2.0.0`, `1.25` and `1.25.x` match any patch, comparators separated by
+// space or comma are all matched and `||` separates alternatives
+func ParseConstraint(s string) (*Constraint, error) {
+	var constraint Constraint
+	for _, alternative := range strings.Split(s, "||") {
+		var set []comparator
+		for _, field := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' }) {
+			comparators, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			set = append(set, comparators...)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("invalid constraint: %q", s)
+		}
+		constraint.sets = append(constraint.sets, set)
+	}
+
+	return &constraint, nil
+}
+
+// parseComparator expand `~`, `^` and wildcard to lower and upper bounds
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, prefix) {
+			op, s = prefix, strings.TrimPrefix(s, prefix)
+			break
+		}
+	}
+	version, parts, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+	if s == "*" || s == "x" {
+		return []comparator{{op: ">=", version: Version{}}}, nil
+	}
+
+	// bump return the smallest version greater than all versions with prefix of n parts
+	bump := func(n int) Version {
+		switch n {
+		case 0:
+			return Version{Major: version.Major + 1, Pre: "0"}
+		case 1:
+			return Version{Major: version.Major, Minor: version.Minor + 1, Pre: "0"}
+		}
+		return Version{Major: version.Major, Minor: version.Minor, Patch: version.Patch + 1, Pre: "0"}
+	}
+	known := 0
+	for known < 3 && parts[known] >= 0 {
+		known++
+	}
+	lower := comparator{op: ">=", version: version}
+
+	switch op {
+	case "~":
+		return []comparator{lower, {op: "<", version: bump(max(min(known, 2), 1) - 1)}}, nil
+	case "^":
+		// the first non-zero part is kept
+		n := 0
+		for n < known-1 && []int{version.Major, version.Minor, version.Patch}[n] == 0 {
+			n++
+		}
+		return []comparator{lower, {op: "<", version: bump(n)}}, nil
+	case "", "=":
+		if known == 3 {
+			return []comparator{{op: "=", version: version}}, nil
+		}
+		return []comparator{lower, {op: "<", version: bump(known - 1)}}, nil
+	case ">":
+		if known < 3 {
+			return []comparator{{op: ">=", version: bump(known - 1)}}, nil
+		}
+	case "<=":
+		if known < 3 {
+			return []comparator{{op: "<", version: bump(known - 1)}}, nil
+		}
+	}
+
+	return []comparator{{op: op, version: version}}, nil
+}
+
+func (c comparator) check(v Version) bool {
+	compare := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return compare == 0
+	case "!=":
+		return compare != 0
+	case ">":
+		return compare > 0
+	case ">=":
+		return compare >= 0
+	case "<":
+		return compare < 0
+	case "<=":
+		return compare <= 0
+	}
+	return false
+}
+
+// Check whether version is in range, pre-release only matches comparator with pre-release of the same version
+func (c *Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		matched := true
+		allowPre := v.Pre == ""
+		for _, comparator := range set {
+			if !comparator.check(v) {
+				matched = false
+				break
+			}
+			cv := comparator.version
+			if cv.Pre != "" && cv.Pre != "0" && cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch {
+				allowPre = true
+			}
+		}
+		if matched && allowPre {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckTag whether tag is version in range, tags which aren't versions never match
+func (c *Constraint) CheckTag(tag string) bool {
+	v, err := ParseVersion(tag)
+	return err == nil && c.Check(v)
+}
+
+// SortTags sort tags by version, tags which aren't versions follow by name
+func SortTags(tags []string) {
+	slices.SortStableFunc(tags, func(a, b string) int {
+		va, aErr := ParseVersion(a)
+		vb, bErr := ParseVersion(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := va.Compare(vb); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// LatestMatching return the greatest version of tags in range, empty if none matches
+func (c *Constraint) LatestMatching(tags []string) string {
+	var (
+		latest  string
+		version Version
+	)
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if latest == "" || v.Compare(version) > 0 || (v.Compare(version) == 0 && len(tag) > len(latest)) {
+			latest, version = tag, v
+		}
+	}
+
+	return latest
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConstraint(t *testing.T) {
+	cases := map[string]map[string]bool{
+		"~1.25":          {"1.25": true, "1.25.3": true, "v1.25.9": true, "1.26.0": false, "1.24.9": false, "1.25.3-alpine": false},
+		"^1.2":           {"1.2.0": true, "1.9.1": true, "2.0.0": false, "2.0.0-rc.1": false, "1.1.9": false},
+		"^0.2.3":         {"0.2.5": true, "0.3.0": false},
+		"1.25.x || >=2":  {"1.25.1": true, "1.26.0": false, "2.1": true},
+		">=1.2, <1.4":    {"1.3.7": true, "1.4.0": false},
+		">1.25":          {"1.25.9": false, "1.26.0": true},
+		"1.25.3":         {"1.25.3": true, "1.25.4": false},
+		">=2.0.0-rc.1":   {"2.0.0-rc.2": true, "2.0.0": true, "2.1.0-rc.1": false},
+		"<=1.25, !=1.24": {"1.25.7": true, "1.24.0": false, "1.26.0": false},
+	}
+	for input, tags := range cases {
+		constraint, err := ParseConstraint(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for tag, want := range tags {
+			if got := constraint.CheckTag(tag); got != want {
+				t.Errorf("%s matches %s: got %v, want %v", input, tag, got, want)
+			}
+		}
+	}
+
+	for _, input := range []string{"", "~abc", "||"} {
+		if _, err := ParseConstraint(input); err == nil {
+			t.Errorf("expected error of %q", input)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tags := []string{"1.10.0", "1.2.0", "1.2.0-rc.10", "1.2.0-rc.2", "1.2.0-beta", "0.9"}
+	slices.SortFunc(tags, func(a, b string) int {
+		va, _ := ParseVersion(a)
+		vb, _ := ParseVersion(b)
+		return va.Compare(vb)
+	})
+	want := []string{"0.9", "1.2.0-beta", "1.2.0-rc.2", "1.2.0-rc.10", "1.2.0", "1.10.0"}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got %v, want %v", tags, want)
+	}
+
+	if _, err := ParseVersion("latest"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSortTags(t *testing.T) {
+	tags := []string{"latest", "1.25.10", "alpine", "1.25.9", "1.26.0-rc.1", "v1.24"}
+	SortTags(tags)
+	want := []string{"v1.24", "1.25.9", "1.25.10", "1.26.0-rc.1", "alpine", "latest"}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got %v, want %v", tags, want)
+	}
+
+	constraint, _ := ParseConstraint("~1.25")
+	if latest := constraint.LatestMatching(append(tags, "1.25", "1.25.9-alpine")); latest != "1.25.10" {
+		t.Fatalf("unexpected latest: %s", latest)
+	}
+	constraint, _ = ParseConstraint("^2")
+	if latest := constraint.LatestMatching(tags); latest != "" {
+		t.Fatalf("unexpected latest: %s", latest)
+	}
+}
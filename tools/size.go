@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []string{"B", "K", "M", "G", "T"}
+
+// ParseSize parse human readable size like `5M`, `2G`, `512KiB` to bytes, units are 1024 based
+func ParseSize(s string) (int64, error) {
+	value := strings.TrimSpace(strings.ToUpper(s))
+	value = strings.TrimSuffix(value, "IB")
+	value = strings.TrimSuffix(value, "B")
+	if value == "" {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	multiple := int64(1)
+	for index, unit := range sizeUnits[1:] {
+		if strings.HasSuffix(value, unit) {
+			value = strings.TrimSuffix(value, unit)
+			multiple = 1 << (10 * (index + 1))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	return int64(n * float64(multiple)), nil
+}
+
+// HumanSize format bytes to human readable size like `1.5M`
+func HumanSize(size int64) string {
+	value := float64(size)
+	index := 0
+	for value >= 1024 && index < len(sizeUnits)-1 {
+		value /= 1024
+		index++
+	}
+	if index == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	return fmt.Sprintf("%.1f%s", value, sizeUnits[index])
+}
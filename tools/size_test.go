@@ -0,0 +1,27 @@
+package tools
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":    512,
+		"5M":     5 << 20,
+		"2G":     2 << 30,
+		"1.5k":   1536,
+		"512KiB": 512 << 10,
+		"100MB":  100 << 20,
+	}
+	for input, want := range cases {
+		got, err := ParseSize(input)
+		if err != nil {
+			t.Fatalf("parse %s: %s", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %s: got %d, want %d", input, got, want)
+		}
+	}
+
+	if _, err := ParseSize("abc"); err == nil {
+		t.Fatal("expected error")
+	}
+}
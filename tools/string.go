@@ -2,13 +2,12 @@ package tools
 
 import "strings"
 
-// TODO needs to optimize deal with diffrent type.
-// ParseImage parse name to image and tag
-func ParseImage(name string) (image string, tag string) {
-	imageSplited := strings.Split(name, ":")
-	if len(imageSplited) > 1 {
-		return imageSplited[0], imageSplited[1]
+// SplitRepoTag split `registry:5000/name:tag` to name and tag at the last colon after slash
+func SplitRepoTag(repoTag string) (string, string) {
+	index := strings.LastIndex(repoTag, ":")
+	if index < 0 || strings.Contains(repoTag[index:], "/") {
+		return repoTag, "latest"
 	}
 
-	return name, "latest"
+	return repoTag[:index], repoTag[index+1:]
 }